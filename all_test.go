@@ -1,8 +1,10 @@
 package ngorm
 
 import (
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -38,6 +40,56 @@ func (q *wrapQL) Open() (*DB, error) {
 	return q.DB, nil
 }
 
+//wrapSQLite opens a sqlite database in a new temporary directory, which is
+//removed by Clear. dialect and driver are the names of a registered dialect
+//and sql driver to open the database with instead of sqlite3 and params are
+//the query parameters of the data source name, like ?_foreign_keys=1.
+type wrapSQLite struct {
+	*DB
+	dialect, driver, params string
+	dir                     string
+}
+
+func (s *wrapSQLite) Clear(databases ...string) error {
+	return s.Close()
+}
+
+func (s *wrapSQLite) Close() error {
+	if s.DB == nil {
+		return nil
+	}
+	err := s.DB.Close()
+	s.DB = nil
+	_ = os.RemoveAll(s.dir)
+	return err
+}
+
+func (s *wrapSQLite) Open() (*DB, error) {
+	if s.DB != nil {
+		return s.DB, nil
+	}
+	dir, err := ioutil.TempDir("", "ngorm")
+	if err != nil {
+		return nil, err
+	}
+	source := "file:" + filepath.Join(dir, "test.db") + s.params
+	dialect, driver := s.dialect, s.driver
+	if dialect == "" {
+		dialect = "sqlite3"
+	}
+	if driver == "" {
+		driver = "sqlite3"
+	}
+	d, err := Open(dialect, driver, source)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	s.DB = d
+	s.dir = dir
+	return d, nil
+}
+
 var tsdb []testDB
 
 func initialize() error {
@@ -53,6 +105,12 @@ func AllTestDB() []testDB {
 	return tsdb
 }
 
+//AllTestDBWithSQLite returns AllTestDB followed by a sqlite database, for the
+//tests that are not specific to ql.
+func AllTestDBWithSQLite() []testDB {
+	return append(AllTestDB()[:len(tsdb):len(tsdb)], &wrapSQLite{})
+}
+
 func runWrapDB(t *testing.T, d testDB, f func(*testing.T, *DB)) {
 	db, err := d.Open()
 	if err != nil {
@@ -0,0 +1,711 @@
+package ngorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gernest/ngorm/dialects"
+	"github.com/gernest/ngorm/engine"
+	"github.com/gernest/ngorm/errmsg"
+	"github.com/gernest/ngorm/hooks"
+	"github.com/gernest/ngorm/model"
+	"github.com/gernest/ngorm/scope"
+	"github.com/gernest/ngorm/util"
+)
+
+//Association manages the records that are related to a model through one of
+//its relationship fields. Use DB.Association to get one.
+//
+// has_one, has_many and belongs_to relationships are managed by updating the
+// foreign keys of the related records, nothing is deleted from the database.
+// many_to_many relationships are managed by inserting and deleting rows in the
+// join table.
+//
+// For polymorphic has_one and has_many relationships the type column of the
+// related records is set to the polymorphic value of the relationship, which
+// is the table name of the model unless the POLYMORPHIC_VALUE tag is set, and
+// only the records with that value are considered related.
+//
+// The relationship field of the model is kept in sync with the changes.
+type Association struct {
+	db     *DB
+	source interface{}
+	field  *model.StructField
+	err    error
+}
+
+//Association returns the Association for the relationship field column of the
+//model set by DB.Model. The model must be a pointer to a struct that is
+//already saved.
+//
+//   err := db.Model(&user).Association("Languages").Append(&Language{Name: "Go"})
+func (db *DB) Association(column string) *Association {
+	a := &Association{db: db}
+	if db.e == nil || db.e.Scope.Value == nil {
+		a.err = errors.New("missing model, before calling this startwith db.Model")
+		return a
+	}
+	a.source = db.e.Scope.Value
+	v := reflect.ValueOf(a.source)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		a.err = errmsg.ErrUnaddressable
+		return a
+	}
+	m, err := scope.GetModelStruct(db.NewEngine(), a.source)
+	if err != nil {
+		a.err = err
+		return a
+	}
+	for _, field := range m.StructFields {
+		if field.Name == column || field.DBName == column {
+			a.field = field
+			break
+		}
+	}
+	if a.field == nil {
+		a.err = fmt.Errorf("%s has no field %s", m.ModelType, column)
+	} else if a.field.Relationship == nil {
+		a.err = fmt.Errorf("%s is not a relationship of %s", column, m.ModelType)
+	}
+	return a
+}
+
+//Find loads the related records into out.
+func (a *Association) Find(out interface{}) error {
+	if a.err != nil {
+		return a.err
+	}
+	db, ok, err := a.query(a.db)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		v := reflect.Indirect(reflect.ValueOf(out))
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+			return nil
+		}
+		return errmsg.ErrRecordNotFound
+	}
+	return db.Find(out)
+}
+
+//Count returns the number of related records.
+func (a *Association) Count() (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	db, ok, err := a.query(a.db)
+	if err != nil || !ok {
+		return 0, err
+	}
+	var count int
+	db.e.Scope.Value = reflect.New(a.destType()).Interface()
+	err = db.Count(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+//Append adds values to the relationship. The values must be pointers to the
+//related model or slices of them, new records are created and the foreign keys
+//of existing records are updated.
+//
+// For belongs_to relationships only the last value is kept.
+func (a *Association) Append(values ...interface{}) error {
+	if a.err != nil {
+		return a.err
+	}
+	records, err := a.records(values)
+	if err != nil {
+		return err
+	}
+	return a.transaction(func(db *DB) error {
+		return a.link(db, records)
+	})
+}
+
+//Replace replaces the related records with values. The records that are no
+//longer related are unlinked, see Delete.
+func (a *Association) Replace(values ...interface{}) error {
+	if a.err != nil {
+		return a.err
+	}
+	records, err := a.records(values)
+	if err != nil {
+		return err
+	}
+	err = a.transaction(func(db *DB) error {
+		if err := a.link(db, records); err != nil {
+			return err
+		}
+		if a.field.Relationship.Kind == "belongs_to" {
+			return nil
+		}
+		return a.unlink(db, records, true)
+	})
+	if err != nil {
+		return err
+	}
+	f := a.fieldValue()
+	f.Set(reflect.Zero(f.Type()))
+	a.setField(records)
+	return nil
+}
+
+//Delete removes values from the relationship. The records are not deleted,
+//their foreign keys are set to NULL. For many_to_many relationships the rows
+//in the join table are deleted.
+func (a *Association) Delete(values ...interface{}) error {
+	if a.err != nil {
+		return a.err
+	}
+	records, err := a.records(values)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	err = a.transaction(func(db *DB) error {
+		return a.unlink(db, records, false)
+	})
+	if err != nil {
+		return err
+	}
+	a.removeField(records)
+	return nil
+}
+
+//Clear removes all the records from the relationship, see Delete.
+func (a *Association) Clear() error {
+	if a.err != nil {
+		return a.err
+	}
+	err := a.transaction(func(db *DB) error {
+		return a.unlink(db, nil, false)
+	})
+	if err != nil {
+		return err
+	}
+	f := a.fieldValue()
+	f.Set(reflect.Zero(f.Type()))
+	return nil
+}
+
+// transaction runs fn in a transaction, unless a.db is already bound to one.
+func (a *Association) transaction(fn func(db *DB) error) error {
+	if _, ok := a.db.db.(*model.SQLTx); ok {
+		return fn(a.db)
+	}
+	return a.db.Transaction(fn)
+}
+
+// query returns a *DB with conditions matching the related records. ok is
+// false when it is known that there are no related records.
+func (a *Association) query(db *DB) (ndb *DB, ok bool, err error) {
+	rel := a.field.Relationship
+	ndb = db.Begin()
+	e := db.NewEngine()
+	switch rel.Kind {
+	case "has_one", "has_many":
+		values := util.GetValueFromFields(reflect.ValueOf(a.source), rel.AssociationForeignFieldNames)
+		if err := a.checkKeys(values); err != nil {
+			return nil, false, err
+		}
+		for i, name := range rel.ForeignDBNames {
+			ndb.Where(fmt.Sprintf("%v = ?", scope.Quote(e, name)), values[i])
+		}
+		if rel.PolymorphicDBName != "" {
+			ndb.Where(fmt.Sprintf("%v = ?", scope.Quote(e, rel.PolymorphicDBName)), rel.PolymorphicValue)
+		}
+	case "belongs_to":
+		values := util.GetValueFromFields(reflect.ValueOf(a.source), rel.ForeignFieldNames)
+		for _, v := range values {
+			if v == nil || util.IsBlank(reflect.ValueOf(v)) {
+				return nil, false, nil
+			}
+		}
+		for i, name := range rel.AssociationForeignDBNames {
+			ndb.Where(fmt.Sprintf("%v = ?", scope.Quote(e, name)), values[i])
+		}
+	case "many_to_many":
+		keys, err := a.joinedKeys(db)
+		if err != nil || len(keys) == 0 {
+			return nil, false, err
+		}
+		var columns []string
+		for _, fk := range rel.JoinTableHandler.Destination.ForeignKeys {
+			columns = append(columns, fk.AssociationDBName)
+		}
+		ndb.Where(fmt.Sprintf("%v IN (%v)",
+			scope.ToQueryCondition(e, columns), util.ToQueryMarks(keys)),
+			util.ToQueryValues(keys)...)
+	default:
+		return nil, false, fmt.Errorf("unsupported relation %s for field %s", rel.Kind, a.field.Name)
+	}
+	return ndb, true, nil
+}
+
+// joinedKeys returns the values of the destination keys in the join table rows
+// that belong to the source.
+func (a *Association) joinedKeys(db *DB) ([][]interface{}, error) {
+	j, err := a.joinTable()
+	if err != nil {
+		return nil, err
+	}
+	e := db.NewEngine()
+	condition, err := a.sourceCondition(e, j)
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	for _, fk := range j.Destination.ForeignKeys {
+		columns = append(columns, scope.Quote(e, fk.DBName))
+	}
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE %v",
+		strings.Join(columns, ","), scope.Quote(e, j.TableName), condition)
+	rows, err := db.db.QueryContext(db.ctx, query, e.Scope.SQLVars...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var keys [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		keys = append(keys, values)
+	}
+	return keys, rows.Err()
+}
+
+// link saves records and relates them to the source.
+func (a *Association) link(db *DB, records []reflect.Value) error {
+	rel := a.field.Relationship
+	switch rel.Kind {
+	case "has_one", "has_many":
+		values := util.GetValueFromFields(reflect.ValueOf(a.source), rel.AssociationForeignFieldNames)
+		if err := a.checkKeys(values); err != nil {
+			return err
+		}
+		e := db.NewEngine()
+		for _, record := range records {
+			for i, name := range rel.ForeignFieldNames {
+				field, err := scope.FieldByName(e, record.Interface(), name)
+				if err != nil {
+					return err
+				}
+				if err = field.Set(values[i]); err != nil {
+					return err
+				}
+			}
+			if rel.PolymorphicType != "" {
+				field, err := scope.FieldByName(e, record.Interface(), rel.PolymorphicType)
+				if err != nil {
+					return err
+				}
+				if err = field.Set(rel.PolymorphicValue); err != nil {
+					return err
+				}
+			}
+			if err := db.Save(record.Interface()); err != nil {
+				return err
+			}
+		}
+	case "belongs_to":
+		if len(records) == 0 {
+			return nil
+		}
+		record := records[len(records)-1]
+		if err := db.Save(record.Interface()); err != nil {
+			return err
+		}
+		e := db.NewEngine()
+		values := util.GetValueFromFields(record, rel.AssociationForeignFieldNames)
+		var sets []string
+		for i, name := range rel.ForeignFieldNames {
+			field, err := scope.FieldByName(e, a.source, name)
+			if err != nil {
+				return err
+			}
+			if err = field.Set(values[i]); err != nil {
+				return err
+			}
+			sets = append(sets, fmt.Sprintf("%v = %v",
+				scope.Quote(e, field.DBName), scope.AddToVars(e, values[i])))
+		}
+		condition, err := primaryCondition(e, a.source)
+		if err != nil {
+			return err
+		}
+		err = execAssociation(e, fmt.Sprintf("UPDATE %v SET %v WHERE %v",
+			scope.QuotedTableName(e, a.source), strings.Join(sets, ","), condition))
+		if err != nil {
+			return err
+		}
+		records = records[len(records)-1:]
+	case "many_to_many":
+		j, err := a.joinTable()
+		if err != nil {
+			return err
+		}
+		// fails when the source has a blank primary key
+		if _, err = a.sourceCondition(db.NewEngine(), j); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := db.Save(record.Interface()); err != nil {
+				return err
+			}
+			e := db.NewEngine()
+			expr, err := scope.JoinRelationSQL(e, j, a.source, record.Interface())
+			if err != nil {
+				return err
+			}
+			if expr != nil {
+				_, err = hooks.ExecTx(e, dialects.WrapTX(e.Dialect, expr.Q), expr.Args...)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported relation %s for field %s", rel.Kind, a.field.Name)
+	}
+	a.setField(records)
+	return nil
+}
+
+// unlink removes the records from the relationship, when records is nil all
+// related records are removed. If keep is true all the related records except
+// records are removed instead.
+func (a *Association) unlink(db *DB, records []reflect.Value, keep bool) error {
+	rel := a.field.Relationship
+	e := db.NewEngine()
+	switch rel.Kind {
+	case "has_one", "has_many":
+		values := util.GetValueFromFields(reflect.ValueOf(a.source), rel.AssociationForeignFieldNames)
+		if err := a.checkKeys(values); err != nil {
+			return err
+		}
+		dest := reflect.New(a.destType()).Interface()
+		var sets, conditions []string
+		for i, name := range rel.ForeignDBNames {
+			sets = append(sets, fmt.Sprintf("%v = NULL", scope.Quote(e, name)))
+			conditions = append(conditions, fmt.Sprintf("%v = %v",
+				scope.Quote(e, name), scope.AddToVars(e, values[i])))
+		}
+		if rel.PolymorphicDBName != "" {
+			conditions = append(conditions, fmt.Sprintf("%v = %v",
+				scope.Quote(e, rel.PolymorphicDBName), scope.AddToVars(e, rel.PolymorphicValue)))
+		}
+		if records != nil || keep {
+			c, err := recordsCondition(e, records, keep)
+			if err != nil {
+				return err
+			}
+			if c != "" {
+				conditions = append(conditions, c)
+			}
+		}
+		return execAssociation(e, fmt.Sprintf("UPDATE %v SET %v WHERE %v",
+			scope.QuotedTableName(e, dest), strings.Join(sets, ","),
+			strings.Join(conditions, " AND ")))
+	case "belongs_to":
+		current := util.GetValueFromFields(reflect.ValueOf(a.source), rel.ForeignFieldNames)
+		if records != nil {
+			var related bool
+			for _, record := range records {
+				v := util.GetValueFromFields(record, rel.AssociationForeignFieldNames)
+				if util.EqualAsString(v, current) {
+					related = true
+				}
+			}
+			if !related {
+				return nil
+			}
+		}
+		var sets []string
+		for _, name := range rel.ForeignFieldNames {
+			field, err := scope.FieldByName(e, a.source, name)
+			if err != nil {
+				return err
+			}
+			field.Field.Set(reflect.Zero(field.Field.Type()))
+			sets = append(sets, fmt.Sprintf("%v = NULL", scope.Quote(e, field.DBName)))
+		}
+		condition, err := primaryCondition(e, a.source)
+		if err != nil {
+			return err
+		}
+		return execAssociation(e, fmt.Sprintf("UPDATE %v SET %v WHERE %v",
+			scope.QuotedTableName(e, a.source), strings.Join(sets, ","), condition))
+	case "many_to_many":
+		j, err := a.joinTable()
+		if err != nil {
+			return err
+		}
+		condition, err := a.sourceCondition(e, j)
+		if err != nil {
+			return err
+		}
+		conditions := []string{condition}
+		if records != nil || keep {
+			var columns []string
+			for _, fk := range j.Destination.ForeignKeys {
+				columns = append(columns, fk.DBName)
+			}
+			var keys [][]interface{}
+			for _, record := range records {
+				searchMap := scope.GetSearchMap(e, j, record.Interface())
+				var key []interface{}
+				for _, fk := range j.Destination.ForeignKeys {
+					key = append(key, searchMap[fk.DBName])
+				}
+				keys = append(keys, key)
+			}
+			if c := inCondition(e, columns, keys, keep); c != "" {
+				conditions = append(conditions, c)
+			}
+		}
+		return execAssociation(e, fmt.Sprintf("DELETE FROM %v WHERE %v",
+			scope.Quote(e, j.TableName), strings.Join(conditions, " AND ")))
+	}
+	return fmt.Errorf("unsupported relation %s for field %s", rel.Kind, a.field.Name)
+}
+
+func (a *Association) joinTable() (*model.JoinTableHandler, error) {
+	j := a.field.Relationship.JoinTableHandler
+	if j == nil || len(j.Source.ForeignKeys) == 0 {
+		return nil, fmt.Errorf("missing join table for field %s", a.field.Name)
+	}
+	return j, nil
+}
+
+// sourceCondition returns the condition matching the join table rows of the
+// source.
+func (a *Association) sourceCondition(e *engine.Engine, j *model.JoinTableHandler) (string, error) {
+	searchMap := scope.GetSearchMap(e, j, a.source)
+	var conditions []string
+	for _, fk := range j.Source.ForeignKeys {
+		v, ok := searchMap[fk.DBName]
+		if !ok || v == nil || util.IsBlank(reflect.ValueOf(v)) {
+			return "", fmt.Errorf("can't use %s association of a record with blank primary key", a.field.Name)
+		}
+		conditions = append(conditions, fmt.Sprintf("%v = %v",
+			scope.Quote(e, fk.DBName), scope.AddToVars(e, v)))
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+func (a *Association) checkKeys(values []interface{}) error {
+	if len(values) == 0 {
+		return fmt.Errorf("can't use %s association of a record with blank primary key", a.field.Name)
+	}
+	for _, v := range values {
+		if v == nil || util.IsBlank(reflect.ValueOf(v)) {
+			return fmt.Errorf("can't use %s association of a record with blank primary key", a.field.Name)
+		}
+	}
+	return nil
+}
+
+// destType returns the struct type of the related records.
+func (a *Association) destType() reflect.Type {
+	t := a.field.Struct.Type
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// records returns pointers to the related records held by values.
+func (a *Association) records(values []interface{}) ([]reflect.Value, error) {
+	typ := a.destType()
+	var records []reflect.Value
+	var add func(v reflect.Value) error
+	add = func(v reflect.Value) error {
+		switch {
+		case !v.IsValid():
+			return nil
+		case v.Kind() == reflect.Interface:
+			return add(v.Elem())
+		case v.Kind() == reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				if err := add(v.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		case v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice:
+			return add(v.Elem())
+		case v.Kind() == reflect.Ptr && v.Type().Elem() == typ:
+			if !v.IsNil() {
+				records = append(records, v)
+			}
+			return nil
+		case v.Type() == typ:
+			if v.CanAddr() {
+				records = append(records, v.Addr())
+				return nil
+			}
+			ptr := reflect.New(typ)
+			ptr.Elem().Set(v)
+			records = append(records, ptr)
+			return nil
+		}
+		return fmt.Errorf("can't use %s as %s for field %s", v.Type(), typ, a.field.Name)
+	}
+	for _, value := range values {
+		if err := add(reflect.ValueOf(value)); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func (a *Association) fieldValue() reflect.Value {
+	v := reflect.ValueOf(a.source).Elem()
+	for _, name := range a.field.Names {
+		v = reflect.Indirect(v).FieldByName(name)
+	}
+	return v
+}
+
+// setField adds the records to the relationship field of the source.
+func (a *Association) setField(records []reflect.Value) {
+	f := a.fieldValue()
+	for _, record := range records {
+		switch {
+		case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Ptr:
+			f.Set(reflect.Append(f, record))
+		case f.Kind() == reflect.Slice:
+			f.Set(reflect.Append(f, record.Elem()))
+		case f.Kind() == reflect.Ptr:
+			f.Set(record)
+		default:
+			f.Set(record.Elem())
+		}
+	}
+}
+
+// removeField removes the records from the relationship field of the source.
+func (a *Association) removeField(records []reflect.Value) {
+	e := a.db.NewEngine()
+	f := a.fieldValue()
+	removed := func(v reflect.Value) bool {
+		key := primaryKeyString(e, reflect.Indirect(v))
+		for _, record := range records {
+			if primaryKeyString(e, record.Elem()) == key {
+				return true
+			}
+		}
+		return false
+	}
+	if f.Kind() != reflect.Slice {
+		if removed(f) {
+			f.Set(reflect.Zero(f.Type()))
+		}
+		return
+	}
+	kept := reflect.MakeSlice(f.Type(), 0, f.Len())
+	for i := 0; i < f.Len(); i++ {
+		if !removed(f.Index(i)) {
+			kept = reflect.Append(kept, f.Index(i))
+		}
+	}
+	f.Set(kept)
+}
+
+// primaryKeyString returns the primary keys of the struct value v as a string
+// that can be used for comparison.
+func primaryKeyString(e *engine.Engine, v reflect.Value) string {
+	if !v.IsValid() || v.Kind() != reflect.Struct {
+		return ""
+	}
+	fields, err := scope.PrimaryFields(e, v.Interface())
+	if err != nil {
+		return ""
+	}
+	var key []interface{}
+	for _, field := range fields {
+		key = append(key, field.Field.Interface())
+	}
+	return util.ToString(key)
+}
+
+// primaryCondition returns the condition matching the record value by its
+// primary keys.
+func primaryCondition(e *engine.Engine, value interface{}) (string, error) {
+	fields, err := scope.PrimaryFields(e, value)
+	if err != nil {
+		return "", err
+	}
+	var conditions []string
+	for _, field := range fields {
+		if field.IsBlank {
+			return "", errors.New("primary key can't be blank")
+		}
+		conditions = append(conditions, fmt.Sprintf("%v = %v",
+			scope.Quote(e, field.DBName), scope.AddToVars(e, field.Field.Interface())))
+	}
+	if len(conditions) == 0 {
+		return "", errors.New("missing primary key")
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// recordsCondition returns the condition matching the records by their primary
+// keys, or all the other records if not is true.
+func recordsCondition(e *engine.Engine, records []reflect.Value, not bool) (string, error) {
+	var columns []string
+	var keys [][]interface{}
+	for _, record := range records {
+		fields, err := scope.PrimaryFields(e, record.Interface())
+		if err != nil {
+			return "", err
+		}
+		columns = columns[:0]
+		var key []interface{}
+		for _, field := range fields {
+			columns = append(columns, field.DBName)
+			key = append(key, field.Field.Interface())
+		}
+		keys = append(keys, key)
+	}
+	return inCondition(e, columns, keys, not), nil
+}
+
+// inCondition returns the condition matching the keys of the columns. When
+// there are no keys the condition matches nothing, or everything if not is
+// true.
+func inCondition(e *engine.Engine, columns []string, keys [][]interface{}, not bool) string {
+	if len(keys) == 0 {
+		if not {
+			return ""
+		}
+		return "1 = 0"
+	}
+	op := "IN"
+	if not {
+		op = "NOT IN"
+	}
+	return fmt.Sprintf("%v %v (%v)", scope.ToQueryCondition(e, columns), op,
+		scope.AddToVars(e, &model.Expr{
+			Q: util.ToQueryMarks(keys), Args: util.ToQueryValues(keys)}))
+}
+
+// execAssociation executes query with the variables bound to e.
+func execAssociation(e *engine.Engine, query string) error {
+	_, err := hooks.ExecTx(e, dialects.WrapTX(e.Dialect, query), e.Scope.SQLVars...)
+	return err
+}
@@ -7,23 +7,27 @@
 package builder
 
 import (
+	"bytes"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/gernest/ngorm/clause"
+	"github.com/gernest/ngorm/dialects"
 	"github.com/gernest/ngorm/engine"
 	"github.com/gernest/ngorm/model"
 	"github.com/gernest/ngorm/regexes"
 	"github.com/gernest/ngorm/scope"
+	"github.com/gernest/ngorm/util"
 )
 
-//Where buiilds the sql where condition. The clause is a map
-//of two important keys, one is query and the second is args. It is possible to
-//use a struct instead of a map for clause, but for now we can stick with this
-//else we will need to do a giant refactoring.
+//Where buiilds the sql where condition. The clause c holds the query and the
+//positional args.
 //
 // query value can be of several types.
 //
@@ -34,10 +38,11 @@ import (
 //  []uint16,[]uint32,[]uint64, []string, []interface{}
 //  map[string]interface{}:
 //  struct
+//  clause.Expression
 //
 // Note that if you supply a query as a struct then it should be a model.
 // Example of a clause is,
-//  map[string]interface{}{"query": query, "args": values}
+//  &model.Clause{Query: query, Args: values}
 // Where query can be anything of the above types and values is possibly a slice
 // of positional values. Positional values are values which will be inserted in
 // place of a placeholder e.g ?. For instance s querry,
@@ -57,8 +62,20 @@ import (
 // specific. For example ql uses $1,$2,$3 etc but also supports ?. You don't
 // have to worry about this, it is automatically handled by the supported
 // database dialects.
-func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface{}) (str string, err error) {
-	switch value := clause["query"].(type) {
+//
+// Named parameters are supported too, when the only positional value is a
+// map[string]interface{} or a struct the @name parameters in query are bound
+// to the values of the matching keys or fields.
+//
+//  select * from home where item=@item && importance=@importance
+//
+// A positional value of type *model.Expr, like a sub query, is merged into the
+// query and its values are bound with scope.AddToVars.
+//
+// A clause.Expression is rendered by Expression.
+func Where(e *engine.Engine, modelValue interface{}, c *model.Clause) (str string, err error) {
+	args := c.Args
+	switch value := c.Query.(type) {
 	case string:
 		if regexes.IsNumber.MatchString(value) {
 			return PrimaryCondition(e, modelValue, scope.AddToVars(e, value))
@@ -75,7 +92,9 @@ func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface
 		str = fmt.Sprintf("(%v%v IN (?))",
 			e.Dialect.QueryFieldName(scope.QuotedTableName(e, modelValue)),
 			scope.Quote(e, pk))
-		clause["args"] = []interface{}{value}
+		args = []interface{}{value}
+	case clause.Expression:
+		return Expression(e, value)
 	case map[string]interface{}:
 		var sqls []string
 		for key, value := range value {
@@ -113,7 +132,16 @@ func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface
 		}
 	}
 
-	args := clause["args"].([]interface{})
+	return bindArgs(e, str, args)
+}
+
+// bindArgs replaces the ? placeholders in str with the positional values in
+// args, see Where.
+func bindArgs(e *engine.Engine, str string, args []interface{}) (string, error) {
+	str, args, err := namedParams(str, args)
+	if err != nil {
+		return "", err
+	}
 	for _, arg := range args {
 		switch reflect.ValueOf(arg).Kind() {
 		case reflect.Slice: // For where("id in (?)", []int64{1,2})
@@ -130,14 +158,186 @@ func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface
 					scope.AddToVars(e, &model.Expr{Q: "NULL"}), 1)
 			}
 		default:
-			if valuer, ok := interface{}(arg).(driver.Valuer); ok {
-				arg, _ = valuer.Value()
+			str = strings.Replace(str, "?", scope.AddToVars(e, valuerValue(arg)), 1)
+		}
+	}
+	return str, nil
+}
+
+// valuerValue returns the value of v if it implements driver.Valuer.
+func valuerValue(v interface{}) interface{} {
+	if valuer, ok := v.(driver.Valuer); ok {
+		v, _ = valuer.Value()
+	}
+	return v
+}
+
+//Expression renders the typed condition x. Column names are quoted and the
+//values are bound with the placeholders of the dialect, expressions that
+//match nothing, like an empty clause.In, are rendered as IN (NULL). An empty
+//string is returned for empty clause.And, clause.Or and clause.Raw.
+func Expression(e *engine.Engine, x clause.Expression) (string, error) {
+	switch v := x.(type) {
+	case clause.Eq:
+		if v.Value == nil {
+			return fmt.Sprintf("(%v IS NULL)", scope.Quote(e, v.Column)), nil
+		}
+		return fmt.Sprintf("(%v = %v)", scope.Quote(e, v.Column),
+			scope.AddToVars(e, valuerValue(v.Value))), nil
+	case clause.In:
+		if len(v.Values) == 0 {
+			return fmt.Sprintf("(%v IN (NULL))", scope.Quote(e, v.Column)), nil
+		}
+		var marks []string
+		for _, value := range v.Values {
+			marks = append(marks, scope.AddToVars(e, valuerValue(value)))
+		}
+		return fmt.Sprintf("(%v IN (%v))", scope.Quote(e, v.Column),
+			strings.Join(marks, ",")), nil
+	case clause.Between:
+		return fmt.Sprintf("(%v BETWEEN %v AND %v)", scope.Quote(e, v.Column),
+			scope.AddToVars(e, valuerValue(v.From)),
+			scope.AddToVars(e, valuerValue(v.To))), nil
+	case clause.And:
+		return junction(e, v, " AND ")
+	case clause.Or:
+		return junction(e, v, " OR ")
+	case clause.Not:
+		if v.Expr == nil {
+			return "", errors.New("missing expression for clause.Not")
+		}
+		str, err := Expression(e, v.Expr)
+		if err != nil || str == "" {
+			return "", err
+		}
+		return fmt.Sprintf("(NOT %v)", str), nil
+	case clause.Raw:
+		if v.SQL == "" {
+			return "", nil
+		}
+		return bindArgs(e, fmt.Sprintf("(%v)", v.SQL), v.Args)
+	}
+	if rv := reflect.ValueOf(x); rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		if ex, ok := rv.Elem().Interface().(clause.Expression); ok {
+			return Expression(e, ex)
+		}
+	}
+	return "", fmt.Errorf("unsupported expression %T", x)
+}
+
+// junction renders the expressions joined by sep.
+func junction(e *engine.Engine, exprs []clause.Expression, sep string) (string, error) {
+	var sqls []string
+	for _, x := range exprs {
+		str, err := Expression(e, x)
+		if err != nil {
+			return "", err
+		}
+		if str != "" {
+			sqls = append(sqls, str)
+		}
+	}
+	switch len(sqls) {
+	case 0:
+		return "", nil
+	case 1:
+		return sqls[0], nil
+	}
+	return fmt.Sprintf("(%v)", strings.Join(sqls, sep)), nil
+}
+
+// namedParams replaces the @name parameters in query with ? when args is a
+// single map[string]interface{} or struct, the returned args are the values of
+// the parameters in the order they appear in query. Parameters inside quotes
+// and @@ variables are left as they are.
+//
+// query and args are returned unchanged if there are no named parameters.
+func namedParams(query string, args []interface{}) (string, []interface{}, error) {
+	if len(args) != 1 || !strings.Contains(query, "@") {
+		return query, args, nil
+	}
+	lookup := namedLookup(args[0])
+	if lookup == nil {
+		return query, args, nil
+	}
+	var (
+		buf    bytes.Buffer
+		values []interface{}
+		quote  byte
+		found  bool
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '@' && (i == 0 || query[i-1] != '@') &&
+			i+1 < len(query) && isNameStart(query[i+1]):
+			j := i + 1
+			for j < len(query) && (isNameStart(query[j]) || query[j] >= '0' && query[j] <= '9') {
+				j++
+			}
+			name := query[i+1 : j]
+			v, ok := lookup(name)
+			if !ok {
+				return "", nil, fmt.Errorf("missing value for named parameter @%s", name)
 			}
+			_ = buf.WriteByte('?')
+			values = append(values, v)
+			found = true
+			i = j - 1
+			continue
+		}
+		_ = buf.WriteByte(c)
+	}
+	if !found {
+		return query, args, nil
+	}
+	return buf.String(), values, nil
+}
 
-			str = strings.Replace(str, "?", scope.AddToVars(e, arg), 1)
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// namedLookup returns a function for looking up the value of named parameters
+// in arg, or nil if arg can't hold named parameters. Struct fields are matched
+// by name, column name or the name set by the COLUMN tag.
+func namedLookup(arg interface{}) func(string) (interface{}, bool) {
+	if m, ok := arg.(map[string]interface{}); ok {
+		return func(name string) (interface{}, bool) {
+			v, ok := m[name]
+			return v, ok
 		}
 	}
-	return
+	if _, ok := arg.(driver.Valuer); ok {
+		return nil
+	}
+	if _, ok := arg.(time.Time); ok {
+		return nil
+	}
+	v := reflect.Indirect(reflect.ValueOf(arg))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	return func(name string) (interface{}, bool) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			column := model.ParseTagSetting(f.Tag)["COLUMN"]
+			if f.Name == name || column == name || column == "" && util.ToDBName(f.Name) == name {
+				return v.Field(i).Interface(), true
+			}
+		}
+		return nil, false
+	}
 }
 
 //PrimaryCondition generates WHERE clause with the value set for primary key.
@@ -166,47 +366,51 @@ func WhereSQL(e *engine.Engine, modelValue interface{}) (sql string, err error)
 		primaryConditions, andConditions, orConditions []string
 	)
 
-	if !e.Search.Unscoped && scope.HasColumn(e, modelValue, "deleted_at") {
-		sql := fmt.Sprintf("%vdeleted_at IS NULL",
-			e.Dialect.QueryFieldName(quotedTableName))
-		primaryConditions = append(primaryConditions, sql)
-	}
+	// Raw queries are used as they are, so the conditions implied by
+	// modelValue are only added to the other queries.
+	if !e.Search.Raw {
+		if !e.Search.Unscoped && scope.HasColumn(e, modelValue, "deleted_at") {
+			sql := fmt.Sprintf("%vdeleted_at IS NULL",
+				e.Dialect.QueryFieldName(quotedTableName))
+			primaryConditions = append(primaryConditions, sql)
+		}
 
-	f, err := scope.PrimaryField(e, modelValue)
-	if err != nil {
-		return "", err
-	}
-	if !(f == nil || f.IsBlank) {
-		pfs, err := scope.PrimaryFields(e, modelValue)
+		f, err := scope.PrimaryField(e, modelValue)
 		if err != nil {
 			return "", err
 		}
-		for _, field := range pfs {
-			sql := fmt.Sprintf("%v%v = %v",
-				e.Dialect.QueryFieldName(quotedTableName),
-				scope.Quote(e, field.DBName), scope.AddToVars(e, field.Field.Interface()))
-			primaryConditions = append(primaryConditions, sql)
+		if !(f == nil || f.IsBlank) {
+			pfs, err := scope.PrimaryFields(e, modelValue)
+			if err != nil {
+				return "", err
+			}
+			for _, field := range pfs {
+				sql := fmt.Sprintf("%v%v = %v",
+					e.Dialect.QueryFieldName(quotedTableName),
+					scope.Quote(e, field.DBName), scope.AddToVars(e, field.Field.Interface()))
+				primaryConditions = append(primaryConditions, sql)
+			}
 		}
 	}
 
-	for _, clause := range e.Search.WhereConditions {
-		sql, err := Where(e, modelValue, clause)
+	for _, c := range e.Search.WhereConditions {
+		sql, err := Where(e, modelValue, c)
 		if err != nil {
 			return "", err
 		}
 		andConditions = append(andConditions, sql)
 	}
 
-	for _, clause := range e.Search.OrConditions {
-		sql, err := Where(e, modelValue, clause)
+	for _, c := range e.Search.OrConditions {
+		sql, err := Where(e, modelValue, c)
 		if err != nil {
 			return "", err
 		}
 		orConditions = append(orConditions, sql)
 	}
 
-	for _, clause := range e.Search.NotConditions {
-		sql, err := Not(e, modelValue, clause)
+	for _, c := range e.Search.NotConditions {
+		sql, err := Not(e, modelValue, c)
 		if err != nil {
 			return "", err
 		}
@@ -234,8 +438,8 @@ func WhereSQL(e *engine.Engine, modelValue interface{}) (sql string, err error)
 	return
 }
 
-//Not generates sql for NOT condition. This accepts clause with two keys, one
-//for query and the other for args( positional arguments)
+//Not generates sql for NOT condition. The clause c holds the query and the
+//args( positional arguments)
 //
 // query value can be of several types.
 //
@@ -246,13 +450,18 @@ func WhereSQL(e *engine.Engine, modelValue interface{}) (sql string, err error)
 //  []uint16,[]uint32,[]uint64, []string, []interface{}
 //  map[string]interface{}:
 //  struct
-func Not(e *engine.Engine, modelValue interface{}, clause map[string]interface{}) (str string, err error) {
+//  clause.Expression
+func Not(e *engine.Engine, modelValue interface{}, c *model.Clause) (str string, err error) {
+	if x, ok := c.Query.(clause.Expression); ok {
+		return Expression(e, clause.Not{Expr: x})
+	}
 	var notEqualSQL string
 	primaryKey, err := scope.PrimaryKey(e, modelValue)
 	if err != nil {
 		return "", err
 	}
-	switch value := clause["query"].(type) {
+	args := c.Args
+	switch value := c.Query.(type) {
 	case string:
 		if regexes.IsNumber.MatchString(value) {
 			id, _ := strconv.Atoi(value)
@@ -269,7 +478,7 @@ func Not(e *engine.Engine, modelValue interface{}, clause map[string]interface{}
 	case []int, []int8, []int16, []int32, []int64, []uint, []uint8, []uint16, []uint32, []uint64, []string:
 		if reflect.ValueOf(value).Len() > 0 {
 			str = fmt.Sprintf("(%v.%v NOT IN (?))", scope.QuotedTableName(e, modelValue), scope.Quote(e, primaryKey))
-			clause["args"] = []interface{}{value}
+			args = []interface{}{value}
 		} else {
 			return "", nil
 		}
@@ -309,7 +518,6 @@ func Not(e *engine.Engine, modelValue interface{}, clause map[string]interface{}
 
 	}
 
-	args := clause["args"].([]interface{})
 	for _, arg := range args {
 		switch reflect.ValueOf(arg).Kind() {
 		case reflect.Slice: // For where("id in (?)", []int64{1,2})
@@ -336,7 +544,7 @@ func Not(e *engine.Engine, modelValue interface{}, clause map[string]interface{}
 
 //SelectSQL builds SELECT clause for modelValue using engine e as context.
 func SelectSQL(e *engine.Engine, modelValue interface{}) string {
-	if len(e.Search.Selects) == 0 {
+	if e.Search.Selects == nil {
 		if len(e.Search.JoinConditions) > 0 {
 			return fmt.Sprintf("%v.*", scope.QuotedTableName(e, modelValue))
 		}
@@ -346,16 +554,15 @@ func SelectSQL(e *engine.Engine, modelValue interface{}) string {
 }
 
 //Select builds select query
-func Select(e *engine.Engine, modelValue interface{}, clause map[string]interface{}) (str string) {
-	switch value := clause["query"].(type) {
+func Select(e *engine.Engine, modelValue interface{}, c *model.Clause) (str string) {
+	switch value := c.Query.(type) {
 	case string:
 		str = value
 	case []string:
 		str = strings.Join(value, ", ")
 	}
 
-	args := clause["args"].([]interface{})
-	for _, arg := range args {
+	for _, arg := range c.Args {
 		switch reflect.ValueOf(arg).Kind() {
 		case reflect.Slice:
 			values := reflect.ValueOf(arg)
@@ -377,8 +584,8 @@ func Select(e *engine.Engine, modelValue interface{}, clause map[string]interfac
 //JoinSQL bilds JOIN SQL clause for modelValue using engine e as context.
 func JoinSQL(e *engine.Engine, modelValue interface{}) (string, error) {
 	var j []string
-	for _, clause := range e.Search.JoinConditions {
-		sql, err := Where(e, modelValue, clause)
+	for _, c := range e.Search.JoinConditions {
+		sql, err := Where(e, modelValue, c)
 		if err != nil {
 			return "", err
 		}
@@ -433,8 +640,8 @@ func HavingSQL(e *engine.Engine, modelValue interface{}) (string, error) {
 		return "", nil
 	}
 	var andConditions []string
-	for _, clause := range e.Search.HavingConditions {
-		sql, err := Where(e, modelValue, clause)
+	for _, c := range e.Search.HavingConditions {
+		sql, err := Where(e, modelValue, c)
 		if err != nil {
 			return "", err
 		}
@@ -463,7 +670,7 @@ func PrepareQuerySQL(e *engine.Engine, modelValue interface{}) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		return strings.Replace(c, "$$", "?", -1), nil
+		return strings.TrimSpace(strings.Replace(c, "$$", "?", -1)), nil
 	}
 	c, err := CombinedCondition(e, modelValue)
 	if err != nil {
@@ -494,37 +701,63 @@ func CombinedCondition(e *engine.Engine, modelValue interface{}) (string, error)
 	if err != nil {
 		return "", err
 	}
+	order := OrderSQL(e, modelValue)
+	limitAndOffset := LimitAndOffsetSQL(e)
+	if order == "" && limitAndOffset != "" && dialects.NeedsOrder(e.Dialect) {
+		order = DefaultOrderSQL(e, modelValue)
+	}
 	return joinSQL + whereSQL + GroupSQL(e) + having +
-		OrderSQL(e, modelValue) + LimitAndOffsetSQL(e), nil
+		order + limitAndOffset, nil
 }
 
-// AddIndex builds SQL to add index for columns with given name
-func AddIndex(e *engine.Engine, unique bool, indexName string, column ...string) error {
-	if e.Dialect.HasIndex(scope.TableName(e, e.Scope.Value), indexName) {
-		return fmt.Errorf("index %s exists", indexName)
-	}
-
-	var columns []string
-	for _, name := range column {
-		if regexes.Column.MatchString(name) {
-			name = scope.Quote(e, name)
+//DefaultOrderSQL returns the ORDER BY clause used when paginating queries
+//without explicit orders for dialects that need one, like mssql. The results
+//are ordered by the primary key of modelValue, when there is no primary key or
+//orders are ignored the order is left to the database.
+func DefaultOrderSQL(e *engine.Engine, modelValue interface{}) string {
+	if !e.Search.IgnoreOrderQuery {
+		if key, err := scope.PrimaryKey(e, modelValue); err == nil && key != "" {
+			table := scope.TableName(e, modelValue)
+			if table == "" || strings.Contains(table, " ") {
+				return " ORDER BY " + scope.Quote(e, key)
+			}
+			return " ORDER BY " + scope.Quote(e, table) + "." + scope.Quote(e, key)
 		}
-		columns = append(columns, name)
 	}
+	return " ORDER BY (SELECT NULL)"
+}
 
-	sqlCreate := "CREATE INDEX"
-	if unique {
-		sqlCreate = "CREATE UNIQUE INDEX"
+// AddIndex builds SQL to add index for columns with given name
+func AddIndex(e *engine.Engine, unique bool, indexName string, column ...string) error {
+	return CreateIndex(e, &model.Index{Name: indexName, Columns: column, Unique: unique})
+}
+
+// CreateIndex builds the CREATE INDEX statement of index on the table of
+// e.Scope.Value, with the options of index like its sort orders, see
+// model.Index. The search conditions are added to the WHERE predicate of the
+// index.
+//
+// It returns an error if the index exists or if the dialect can't express one
+// of its options, see dialects.CreateIndexSQL.
+func CreateIndex(e *engine.Engine, index *model.Index) error {
+	if e.Dialect.HasIndex(scope.TableName(e, e.Scope.Value), index.Name) {
+		return fmt.Errorf("index %s exists", index.Name)
 	}
 	w, err := WhereSQL(e, e.Scope.Value)
 	if err != nil {
 		return err
 	}
-
-	e.Scope.SQL = fmt.Sprintf("%s %v ON %v(%v) %v",
-		sqlCreate, indexName,
-		scope.QuotedTableName(e, e.Scope.Value),
-		strings.Join(columns, ", "), w,
-	)
+	idx := *index
+	if w = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(w), "WHERE")); w != "" {
+		if idx.Where != "" {
+			w = "(" + idx.Where + ") AND " + w
+		}
+		idx.Where = w
+	}
+	query, err := dialects.CreateIndexSQL(e.Dialect, scope.QuotedTableName(e, e.Scope.Value), &idx)
+	if err != nil {
+		return err
+	}
+	e.Scope.SQL = query
 	return nil
 }
@@ -5,8 +5,11 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/gernest/ngorm/clause"
+	"github.com/gernest/ngorm/dialects/postgres"
 	"github.com/gernest/ngorm/dialects/ql"
 	"github.com/gernest/ngorm/fixture"
+	"github.com/gernest/ngorm/model"
 	"github.com/gernest/ngorm/search"
 )
 
@@ -172,6 +175,110 @@ func TestWhere(t *testing.T) {
 	}
 }
 
+func TestWhere_named(t *testing.T) {
+	var user fixture.User
+	sample := []struct {
+		query  string
+		args   []interface{}
+		expect string
+		vars   string
+	}{
+		{"name = @name AND age > @age",
+			[]interface{}{map[string]interface{}{"name": "gernest", "age": 18}},
+			"(name = $1 AND age > $2)", "[gernest 18]"},
+		{"name = @Name OR name = @name",
+			[]interface{}{struct{ Name string }{"gernest"}},
+			"(name = $1 OR name = $2)", "[gernest gernest]"},
+		{"email = 'me@example.com' AND @@version > @v",
+			[]interface{}{map[string]interface{}{"v": 1}},
+			"(email = 'me@example.com' AND @@version > $1)", "[1]"},
+		{"name = ? AND nick = @name",
+			[]interface{}{"gernest"},
+			"(name = $1 AND nick = @name)", "[gernest]"},
+	}
+	for _, v := range sample {
+		e := fixture.TestEngine()
+		e.Dialect = ql.Memory()
+		search.Where(e, v.query, v.args...)
+		s, err := Where(e, &user, e.Search.WhereConditions[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != v.expect {
+			t.Errorf("expected %s got %s", v.expect, s)
+		}
+		if vars := fmt.Sprint(e.Scope.SQLVars); vars != v.vars {
+			t.Errorf("expected %s got %s", v.vars, vars)
+		}
+	}
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	search.Where(e, "name = @missing", map[string]interface{}{})
+	_, err := Where(e, &user, e.Search.WhereConditions[0])
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestExpression(t *testing.T) {
+	sample := []struct {
+		expr   clause.Expression
+		expect string
+		vars   string
+	}{
+		{clause.Eq{Column: "name", Value: "gernest"}, `("name" = $1)`, "[gernest]"},
+		{clause.Eq{Column: "users.name"}, `("users"."name" IS NULL)`, "[]"},
+		{clause.In{Column: "age", Values: []interface{}{1, 2}}, `("age" IN ($1,$2))`, "[1 2]"},
+		{clause.In{Column: "age"}, `("age" IN (NULL))`, "[]"},
+		{clause.Between{Column: "age", From: 1, To: 9}, `("age" BETWEEN $1 AND $2)`, "[1 9]"},
+		{clause.Or{
+			clause.Eq{Column: "name", Value: "a"},
+			clause.And{
+				clause.Raw{SQL: "age > ?", Args: []interface{}{18}},
+				clause.Not{Expr: &clause.Eq{Column: "admin", Value: true}},
+			},
+		}, `(("name" = $1) OR ((age > $2) AND (NOT ("admin" = $3))))`, "[a 18 true]"},
+		{clause.And{clause.Raw{}}, "", "[]"},
+	}
+	for _, v := range sample {
+		e := fixture.TestEngine()
+		e.Dialect = postgres.New()
+		s, err := Expression(e, v.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != v.expect {
+			t.Errorf("expected %s got %s", v.expect, s)
+		}
+		if vars := fmt.Sprint(e.Scope.SQLVars); vars != v.vars {
+			t.Errorf("expected %s got %s", v.vars, vars)
+		}
+	}
+
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	var user fixture.User
+	search.Where(e, clause.Eq{Column: "name", Value: "gernest"})
+	search.Not(e, clause.In{Column: "age", Values: []interface{}{1}})
+	s, err := WhereSQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "WHERE (name = $1) AND (NOT (age IN ($2)))"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+
+	// A clause without args must not panic.
+	s, err = Where(e, &user, &model.Clause{Query: "name IS NULL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "(name IS NULL)" {
+		t.Errorf("expected (name IS NULL) got %s", s)
+	}
+}
+
 func TestNot(t *testing.T) {
 	e := fixture.TestEngine()
 	e.Dialect = ql.Memory()
@@ -0,0 +1,89 @@
+//Package clause defines a tree of typed search conditions. The conditions can
+//be composed programmatically and used anywhere a query is accepted, like
+//DB.Where, DB.Or, DB.Not, DB.Having and DB.Joins.
+//
+//	db.Where(clause.Or{
+//		clause.Eq{Column: "name", Value: "gernest"},
+//		clause.And{
+//			clause.In{Column: "age", Values: []interface{}{18, 21}},
+//			clause.Not{Expr: clause.Eq{Column: "deleted", Value: true}},
+//		},
+//	}).Find(&users)
+//
+// The conditions are rendered by the builder package, column names are quoted
+// and values are bound with the placeholders of the dialect in use.
+package clause
+
+//Expression is a search condition. The types defined in this package are the
+//only implementations.
+type Expression interface {
+	expression()
+}
+
+//Eq is the condition Column = Value. A nil Value is rendered as Column IS NULL.
+type Eq struct {
+	Column string
+	Value  interface{}
+}
+
+//In is the condition Column IN (Values...). Empty Values match nothing.
+type In struct {
+	Column string
+	Values []interface{}
+}
+
+//Between is the condition Column BETWEEN From AND To.
+type Between struct {
+	Column   string
+	From, To interface{}
+}
+
+//And is the conjunction of the expressions.
+type And []Expression
+
+//Or is the disjunction of the expressions.
+type Or []Expression
+
+//Not negates Expr.
+type Not struct {
+	Expr Expression
+}
+
+//Raw is a condition written in SQL. Args are the positional values for the ?
+//placeholders in SQL, see builder.Where.
+type Raw struct {
+	SQL  string
+	Args []interface{}
+}
+
+func (Eq) expression()      {}
+func (In) expression()      {}
+func (Between) expression() {}
+func (And) expression()     {}
+func (Or) expression()      {}
+func (Not) expression()     {}
+func (Raw) expression()     {}
+
+//Option is an option of the statement built by a query, see DB.Clauses.
+type Option interface {
+	option()
+}
+
+//OnConflict makes an INSERT update the existing row, instead of failing, when
+//the new row conflicts with it on the unique Columns.
+//
+//	db.Clauses(clause.OnConflict{
+//		Columns:   []string{"email"},
+//		DoUpdates: []string{"name", "updated_at"},
+//	}).Create(&user)
+type OnConflict struct {
+	// Columns are the columns of the unique index or constraint, the primary
+	// key is used when empty.
+	Columns []string
+
+	// DoUpdates are the columns of the existing row that are set to the
+	// values being inserted. The existing row is left as it is when empty.
+	DoUpdates []string
+}
+
+func (OnConflict) option() {}
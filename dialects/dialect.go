@@ -3,12 +3,17 @@
 package dialects
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/gernest/ngorm/model"
+	"github.com/gernest/ngorm/regexes"
+	"github.com/gernest/ngorm/util"
 )
 
 // Dialect interface contains behaviors that differ across SQL database
@@ -19,6 +24,10 @@ type Dialect interface {
 	// SetDB set db for dialect
 	SetDB(db model.SQLCommon)
 
+	// SetContext sets the context that is used by the queries executed by the
+	// dialect, like HasTable and HasColumn.
+	SetContext(ctx context.Context)
+
 	// BindVar return the placeholder for actual values in SQL statements, in many dbs it is "?", Postgres using $1
 	BindVar(i int) string
 	// Quote quotes field name to avoid SQL parsing exceptions by using a reserved word as a field name
@@ -37,6 +46,12 @@ type Dialect interface {
 	HasTable(tableName string) bool
 	// HasColumn check has column or not
 	HasColumn(tableName string, columnName string) bool
+	// Columns returns the columns of the table. The types are reported in the
+	// same form as DataTypeOf where possible, so the two can be compared.
+	Columns(tableName string) ([]model.Column, error)
+	// Indexes returns the indexes of the table, leaving out the ones that back
+	// the primary key.
+	Indexes(tableName string) ([]model.Index, error)
 
 	// LimitAndOffsetSQL return generated SQL with Limit and Offset, as mssql has special case
 	LimitAndOffsetSQL(limit, offset interface{}) string
@@ -44,6 +59,10 @@ type Dialect interface {
 	SelectFromDummyTable() string
 	// LastInsertIdReturningSuffix most dbs support LastInsertId, but postgres needs to use `RETURNING`
 	LastInsertIDReturningSuffix(tableName, columnName string) string
+	// LastInsertIDOutputInterstitial returns the clause that is placed between
+	// the columns and the VALUES of an INSERT query to return the id of the new
+	// record, mssql needs to use `OUTPUT INSERTED.id`
+	LastInsertIDOutputInterstitial(tableName, columnName string, columns []string) string
 
 	// BuildForeignKeyName returns a foreign key name for the given table, field and reference
 	BuildForeignKeyName(tableName, field, dest string) string
@@ -51,9 +70,346 @@ type Dialect interface {
 	// CurrentDatabase return current database name
 	CurrentDatabase() string
 
+	// PrimaryKey returns the PRIMARY KEY clause for the given quoted columns,
+	// an empty string means primary keys are not supported.
 	PrimaryKey([]string) string
 
 	QueryFieldName(string) string
+
+	// SavePoint returns the sql for creating a savepoint with the given name in
+	// a running transaction. An empty string means savepoints are not supported.
+	SavePoint(name string) string
+	// RollbackToSavePoint returns the sql for rolling back to the savepoint name
+	RollbackToSavePoint(name string) string
+	// ReleaseSavePoint returns the sql for releasing the savepoint name. An empty
+	// string means there is nothing to be done to release the savepoint.
+	ReleaseSavePoint(name string) string
+}
+
+//TxWrapper is implemented by dialects that need the write queries to be wrapped
+//in a BEGIN TRANSACTION; ... COMMIT; block, like ql.
+type TxWrapper interface {
+	NeedsTX() bool
+}
+
+//NeedsTX returns true if the write queries for the dialect d must be wrapped in
+//a BEGIN TRANSACTION; ... COMMIT; block.
+func NeedsTX(d Dialect) bool {
+	w, ok := d.(TxWrapper)
+	return ok && w.NeedsTX()
+}
+
+//WrapTX wraps query in a transaction block if the dialect d needs it, else
+//query is returned as is.
+func WrapTX(d Dialect, query string) string {
+	if NeedsTX(d) {
+		return util.WrapTX(query)
+	}
+	return query
+}
+
+//OrderedPaginator is implemented by dialects that need an ORDER BY clause in
+//queries that are limited or offset, like mssql.
+type OrderedPaginator interface {
+	NeedsOrder() bool
+}
+
+//NeedsOrder returns true if the dialect d needs an ORDER BY clause when
+//paginating queries.
+func NeedsOrder(d Dialect) bool {
+	o, ok := d.(OrderedPaginator)
+	return ok && o.NeedsOrder()
+}
+
+//Upserter is implemented by dialects that can update the conflicting row in
+//the INSERT statement itself. Dialects that don't implement it get a read then
+//write fallback.
+//
+// OnConflictSQL returns the clause appended to the INSERT statement, columns
+// are the quoted columns of the unique constraint and updates the quoted
+// columns that are set to the inserted values. The existing row is left as it
+// is when updates is empty.
+type Upserter interface {
+	OnConflictSQL(columns, updates []string) string
+}
+
+//BatchInserter is implemented by dialects that can insert several rows with a
+//single INSERT ... VALUES (...), (...) statement. Slices are inserted one row
+//at a time for the others.
+//
+// MaxBindVars is the maximum number of bind variables of a statement. The
+// primary keys are read from the rows returned by the statement when the
+// dialect has a LastInsertIDReturningSuffix. Otherwise FirstInsertID returns
+// the key generated for the first of the n inserted rows given the result of
+// LastInsertId, the keys of the other rows follow it. ok is false if the keys
+// can't be known.
+type BatchInserter interface {
+	MaxBindVars() int
+	FirstInsertID(lastInsertID, n int64) (id int64, ok bool)
+}
+
+//ColumnAlterer is implemented by dialects that can change the type, the
+//nullability or the default value of an existing column.
+//
+// AlterColumnSQL returns the statement that changes the column from to the
+// definition to of the quoted table, an empty string if the change can't be
+// expressed. to.Type is the bare type from DataTypeOf, without the NOT NULL,
+// UNIQUE and DEFAULT settings.
+type ColumnAlterer interface {
+	AlterColumnSQL(tableName string, from, to model.Column) string
+}
+
+//IndexDropper is implemented by dialects that need more than the name of the
+//index to drop it, like mysql. The names passed to DropIndexSQL are not quoted.
+type IndexDropper interface {
+	DropIndexSQL(tableName, indexName string) string
+}
+
+//DropIndexSQL returns the statement that drops the index indexName of the
+//table tableName with the dialect d.
+func DropIndexSQL(d Dialect, tableName, indexName string) string {
+	if i, ok := d.(IndexDropper); ok {
+		return i.DropIndexSQL(tableName, indexName)
+	}
+	return "DROP INDEX " + d.Quote(indexName)
+}
+
+//IndexCreator is implemented by dialects that support options of model.Index
+//beyond its columns and uniqueness.
+//
+// CreateIndexSQL returns the CREATE INDEX statement of index on the quoted
+// table tableName, or an error if the dialect can't express one of its options.
+type IndexCreator interface {
+	CreateIndexSQL(tableName string, index *model.Index) (string, error)
+}
+
+//IndexOptions are the options of model.Index supported by a dialect, see
+//CheckIndex.
+type IndexOptions struct {
+	Sort       bool
+	Where      bool
+	Expression bool
+
+	// Types are the index methods of the USING clause.
+	Types []string
+}
+
+//CreateIndexSQL returns the CREATE INDEX statement of index on the quoted table
+//tableName with the dialect d. Dialects that don't implement IndexCreator
+//can't express any option of index.
+func CreateIndexSQL(d Dialect, tableName string, index *model.Index) (string, error) {
+	if c, ok := d.(IndexCreator); ok {
+		return c.CreateIndexSQL(tableName, index)
+	}
+	err := CheckIndex(d, index, IndexOptions{})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %v ON %v(%v)", CreateIndex(index), index.Name,
+		tableName, IndexColumns(d, index)), nil
+}
+
+//CheckIndex returns an error if index has an option that is not in opts.
+func CheckIndex(d Dialect, index *model.Index, opts IndexOptions) error {
+	unsupported := func(option string) error {
+		return fmt.Errorf("%s doesn't support %s of index %s", d.GetName(), option, index.Name)
+	}
+	for _, sort := range index.Sorts {
+		if sort != "" && !opts.Sort {
+			return unsupported("sort orders")
+		}
+	}
+	if index.Where != "" && !opts.Where {
+		return unsupported("WHERE predicates")
+	}
+	for _, column := range index.Columns {
+		if strings.HasPrefix(column, "(") && !opts.Expression {
+			return unsupported("expressions")
+		}
+	}
+	if index.Type != "" {
+		supported := false
+		for _, t := range opts.Types {
+			supported = supported || strings.EqualFold(t, index.Type)
+		}
+		if !supported {
+			return unsupported("USING " + index.Type)
+		}
+	}
+	return nil
+}
+
+//CreateIndex returns CREATE UNIQUE INDEX for unique indexes and CREATE INDEX for
+//the others.
+func CreateIndex(index *model.Index) string {
+	if index.Unique {
+		return "CREATE UNIQUE INDEX"
+	}
+	return "CREATE INDEX"
+}
+
+//IndexColumns returns the comma separated columns of index followed by their
+//sort orders. The names of the columns are quoted by d, expressions are kept
+//as they are.
+func IndexColumns(d Dialect, index *model.Index) string {
+	var columns []string
+	for i, name := range index.Columns {
+		if regexes.Column.MatchString(name) {
+			parts := strings.Split(name, ".")
+			for j := range parts {
+				parts[j] = d.Quote(parts[j])
+			}
+			name = strings.Join(parts, ".")
+		}
+		if i < len(index.Sorts) && index.Sorts[i] != "" {
+			name += " " + index.Sorts[i]
+		}
+		columns = append(columns, name)
+	}
+	return strings.Join(columns, ", ")
+}
+
+//ForeignKeyer is implemented by dialects that support foreign key constraints,
+//no constraints are created with the others, like ql.
+//
+// ForeignKeySQL returns the CONSTRAINT ... FOREIGN KEY clause of fk, or an
+// error if the dialect can't express its referential actions. The clause is
+// part of the CREATE TABLE statement when InlineForeignKeys is true, like with
+// sqlite which can't add constraints to existing tables. Otherwise it is added
+// with ALTER TABLE ... ADD, once the referenced table exists.
+type ForeignKeyer interface {
+	ForeignKeySQL(fk *model.ForeignKey) (string, error)
+	InlineForeignKeys() bool
+}
+
+//ReferentialActions are the ON DELETE and ON UPDATE actions of the SQL
+//standard.
+var ReferentialActions = []string{"CASCADE", "SET NULL", "SET DEFAULT", "RESTRICT", "NO ACTION"}
+
+//ForeignKeySQL returns the standard CONSTRAINT ... FOREIGN KEY clause of fk with
+//the names quoted by d. It returns an error if the OnDelete or OnUpdate action
+//of fk is not one of actions.
+func ForeignKeySQL(d Dialect, fk *model.ForeignKey, actions ...string) (string, error) {
+	quote := func(names []string) string {
+		var q []string
+		for _, name := range names {
+			q = append(q, d.Quote(name))
+		}
+		return strings.Join(q, ",")
+	}
+	s := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(%s)",
+		d.Quote(fk.Name), quote(fk.Columns), d.Quote(fk.RefTable), quote(fk.RefColumns))
+	for _, a := range []struct{ on, action string }{
+		{"DELETE", fk.OnDelete},
+		{"UPDATE", fk.OnUpdate},
+	} {
+		if a.action == "" {
+			continue
+		}
+		supported := false
+		for _, action := range actions {
+			supported = supported || action == a.action
+		}
+		if !supported {
+			return "", fmt.Errorf("%s doesn't support ON %s %s", d.GetName(), a.on, a.action)
+		}
+		s += " ON " + a.on + " " + a.action
+	}
+	return s, nil
+}
+
+//ScanIndexes reads the indexes from rows that have the name of the index, the
+//name of a column and whether the index is unique, ordered by index and then by
+//the position of the column in the index.
+func ScanIndexes(rows *sql.Rows) ([]model.Index, error) {
+	defer func() {
+		_ = rows.Close()
+	}()
+	var indexes []model.Index
+	for rows.Next() {
+		var (
+			name, column string
+			unique       bool
+		)
+		err := rows.Scan(&name, &column, &unique)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+			continue
+		}
+		indexes = append(indexes, model.Index{Name: name, Columns: []string{column}, Unique: unique})
+	}
+	return indexes, rows.Err()
+}
+
+var intWidth = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|integer|bigint)\(\d+\)`)
+
+var typeAliases = map[string]string{
+	"bool":      "boolean",
+	"int":       "integer",
+	"int4":      "integer",
+	"serial":    "integer",
+	"int8":      "bigint",
+	"bigserial": "bigint",
+
+	// ql reports int and uint as int64 and uint64
+	"int64": "integer",
+	"uint":  "uint64",
+}
+
+//SameType returns true if the column types a and b are the same. The case,
+//integer display widths, auto increment settings and aliases like bool and
+//boolean are ignored.
+func SameType(a, b string) bool {
+	return normalizeType(a) == normalizeType(b)
+}
+
+func normalizeType(t string) string {
+	t = strings.Join(strings.Fields(strings.ToLower(t)), " ")
+	for _, s := range []string{" primary key", " autoincrement", " auto_increment", " identity(1,1)"} {
+		t = strings.Replace(t, s, "", -1)
+	}
+	if t == "tinyint(1)" {
+		return "boolean"
+	}
+	t = intWidth.ReplaceAllString(t, "$1")
+	t = strings.Replace(t, "character varying", "varchar", 1)
+	if alias, ok := typeAliases[t]; ok {
+		return alias
+	}
+	return t
+}
+
+//SameDefault returns true if the default value expressions a and b are the
+//same. Enclosing parentheses and quotes, and postgres casts are ignored.
+func SameDefault(a, b string) bool {
+	return strings.EqualFold(normalizeDefault(a), normalizeDefault(b))
+}
+
+func normalizeDefault(v string) string {
+	v = strings.TrimSpace(v)
+	for len(v) >= 2 && v[0] == '(' && v[len(v)-1] == ')' {
+		v = strings.TrimSpace(v[1 : len(v)-1])
+	}
+	if i := strings.LastIndex(v, "::"); i > 0 && !strings.ContainsAny(v[i:], "'\"") {
+		v = v[:i]
+	}
+	if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+		v = v[1 : len(v)-1]
+	}
+	return v
+}
+
+//FieldCanAutoIncrement returns true if the values of the field are generated
+//by the database. This is the case for primary keys unless the AUTO_INCREMENT
+//tag is set to false.
+func FieldCanAutoIncrement(field *model.StructField) bool {
+	if value, ok := field.TagSettings["AUTO_INCREMENT"]; ok {
+		return strings.ToLower(value) != "false"
+	}
+	return field.IsPrimaryKey
 }
 
 //ParseFieldStructForDialect pases metadatab enough to be used by dialects. The values
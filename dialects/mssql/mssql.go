@@ -0,0 +1,370 @@
+// Package mssql exposes implementations and functions that enables ngorm to
+// work with microsoft sql server database.
+//
+// The dialect is registered under the name mssql, which is also the name of the
+// driver registered by github.com/denisenkom/go-mssqldb.
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gernest/ngorm/dialects"
+	"github.com/gernest/ngorm/model"
+	"github.com/gernest/ngorm/regexes"
+)
+
+//MSSQL implements the dialects.Dialect interface that uses microsoft sql server
+//as the SQL backend.
+//
+// Paginated queries use OFFSET ... FETCH NEXT which is only valid after an
+// ORDER BY clause, so the dialect implements dialects.OrderedPaginator.
+type MSSQL struct {
+	db  model.SQLCommon
+	ctx context.Context
+}
+
+func init() {
+	dialects.Register("mssql", func() dialects.Dialect { return New() })
+}
+
+// New returns the dialect for microsoft sql server database.
+func New() *MSSQL {
+	return &MSSQL{ctx: context.Background()}
+}
+
+// GetName get dialect's name
+func (m *MSSQL) GetName() string {
+	return "mssql"
+}
+
+// SetDB set db for dialect
+func (m *MSSQL) SetDB(db model.SQLCommon) {
+	m.db = db
+}
+
+// SetContext sets the context used by the queries executed by the dialect.
+func (m *MSSQL) SetContext(ctx context.Context) {
+	m.ctx = ctx
+}
+
+// BindVar return the placeholder for actual values in SQL statements, mssql
+// uses @p1, @p2 ...
+func (m *MSSQL) BindVar(i int) string {
+	return fmt.Sprintf("@p%d", i)
+}
+
+// Quote quotes field name to avoid SQL parsing exceptions by using a reserved word as a field name
+func (m *MSSQL) Quote(key string) string {
+	return fmt.Sprintf("[%s]", key)
+}
+
+//PrimaryKey implements dialects.Dialect interface. It returns the PRIMARY KEY
+//clause for the keys.
+func (m *MSSQL) PrimaryKey(keys []string) string {
+	return fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(keys, ","))
+}
+
+// DataTypeOf return data's sql type
+//
+// Integer fields that are auto incremented, primary keys by default, are
+// IDENTITY(1,1) columns.
+func (m *MSSQL) DataTypeOf(field *model.StructField) (string, error) {
+	var dataValue, sqlType, size, additionalType = dialects.ParseFieldStructForDialect(field)
+	if sqlType == "" {
+		switch dataValue.Kind() {
+		case reflect.Bool:
+			sqlType = "bit"
+		case reflect.Int,
+			reflect.Int8,
+			reflect.Int16,
+			reflect.Int32,
+			reflect.Uint,
+			reflect.Uint8,
+			reflect.Uint16,
+			reflect.Uint32,
+			reflect.Uintptr:
+			sqlType = m.identity(field, "int")
+		case reflect.Int64, reflect.Uint64:
+			sqlType = m.identity(field, "bigint")
+		case reflect.Float32, reflect.Float64:
+			sqlType = "float"
+		case reflect.String:
+			if size > 0 && size < 8000 {
+				sqlType = fmt.Sprintf("nvarchar(%d)", size)
+			} else {
+				sqlType = "nvarchar(max)"
+			}
+		case reflect.Struct:
+			if _, ok := dataValue.Interface().(time.Time); ok {
+				sqlType = "datetimeoffset"
+			}
+		default:
+			if _, ok := dataValue.Interface().([]byte); ok {
+				if size > 0 && size < 8000 {
+					sqlType = fmt.Sprintf("varbinary(%d)", size)
+				} else {
+					sqlType = "varbinary(max)"
+				}
+			}
+		}
+	}
+	if sqlType == "" {
+		return "", fmt.Errorf("invalid sql type %s (%s) for mssql", dataValue.Type().Name(), dataValue.Kind().String())
+	}
+
+	if strings.TrimSpace(additionalType) == "" {
+		return sqlType, nil
+	}
+	return fmt.Sprintf("%v %v", sqlType, additionalType), nil
+}
+
+func (m *MSSQL) identity(field *model.StructField, sqlType string) string {
+	if dialects.FieldCanAutoIncrement(field) {
+		field.TagSettings["AUTO_INCREMENT"] = "AUTO_INCREMENT"
+		return sqlType + " IDENTITY(1,1)"
+	}
+	return sqlType
+}
+
+// HasIndex check has index or not
+func (m *MSSQL) HasIndex(tableName string, indexName string) bool {
+	query := "SELECT count(*) FROM sys.indexes WHERE name = @p1 AND object_id = OBJECT_ID(@p2)"
+	var count int
+	err := m.db.QueryRowContext(m.ctx, query, indexName, tableName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// HasForeignKey check has foreign key or not
+func (m *MSSQL) HasForeignKey(tableName string, foreignKeyName string) bool {
+	query := "SELECT count(*) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS WHERE table_catalog = DB_NAME() AND table_name = @p1 AND constraint_name = @p2 AND constraint_type = 'FOREIGN KEY'"
+	var count int
+	err := m.db.QueryRowContext(m.ctx, query, tableName, foreignKeyName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// RemoveIndex remove index
+func (m *MSSQL) RemoveIndex(tableName string, indexName string) error {
+	_, err := m.db.ExecContext(m.ctx, fmt.Sprintf("DROP INDEX %v ON %v", m.Quote(indexName), m.Quote(tableName)))
+	return err
+}
+
+// HasTable check has table or not
+func (m *MSSQL) HasTable(tableName string) bool {
+	query := "SELECT count(*) FROM INFORMATION_SCHEMA.TABLES WHERE table_catalog = DB_NAME() AND table_name = @p1"
+	var count int
+	err := m.db.QueryRowContext(m.ctx, query, tableName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// HasColumn check has column or not
+func (m *MSSQL) HasColumn(tableName string, columnName string) bool {
+	query := "SELECT count(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE table_catalog = DB_NAME() AND table_name = @p1 AND column_name = @p2"
+	var count int
+	err := m.db.QueryRowContext(m.ctx, query, tableName, columnName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// Columns returns the columns of the table from INFORMATION_SCHEMA.COLUMNS.
+// The length of character types is part of the type, like nvarchar(255) or
+// nvarchar(max).
+func (m *MSSQL) Columns(tableName string) ([]model.Column, error) {
+	query := "SELECT column_name, data_type, character_maximum_length, is_nullable, column_default FROM INFORMATION_SCHEMA.COLUMNS WHERE table_catalog = DB_NAME() AND table_name = @p1 ORDER BY ordinal_position"
+	rows, err := m.db.QueryContext(m.ctx, query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var columns []model.Column
+	for rows.Next() {
+		var (
+			c          model.Column
+			size       sql.NullInt64
+			isNullable string
+			def        sql.NullString
+		)
+		err = rows.Scan(&c.Name, &c.Type, &size, &isNullable, &def)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case size.Valid && size.Int64 == -1:
+			c.Type += "(max)"
+		case size.Valid:
+			c.Type += fmt.Sprintf("(%d)", size.Int64)
+		}
+		c.Nullable = isNullable == "YES"
+		c.Default, c.HasDefault = def.String, def.Valid
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// Indexes returns the indexes of the table from sys.indexes.
+func (m *MSSQL) Indexes(tableName string) ([]model.Index, error) {
+	query := `SELECT i.name, c.name, i.is_unique
+	FROM sys.indexes i
+	JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+	JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+	WHERE i.object_id = OBJECT_ID(@p1) AND i.is_primary_key = 0 AND i.is_unique_constraint = 0
+	ORDER BY i.name, ic.key_ordinal`
+	rows, err := m.db.QueryContext(m.ctx, query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return dialects.ScanIndexes(rows)
+}
+
+// AlterColumnSQL implements dialects.ColumnAlterer with ALTER COLUMN, which
+// changes the type and the nullability. Defaults are constraints in mssql, so
+// a change of the default alone can't be expressed.
+func (m *MSSQL) AlterColumnSQL(tableName string, from, to model.Column) string {
+	if dialects.SameType(from.Type, to.Type) && from.Nullable == to.Nullable {
+		return ""
+	}
+	null := "NULL"
+	if !to.Nullable {
+		null = "NOT NULL"
+	}
+	return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s %s", tableName, m.Quote(to.Name), to.Type, null)
+}
+
+// DropIndexSQL implements dialects.IndexDropper.
+func (m *MSSQL) DropIndexSQL(tableName, indexName string) string {
+	return fmt.Sprintf("DROP INDEX %v ON %v", m.Quote(indexName), m.Quote(tableName))
+}
+
+// LimitAndOffsetSQL return generated SQL with Limit and Offset. mssql uses
+// OFFSET n ROWS FETCH NEXT m ROWS ONLY, the OFFSET part is required so OFFSET 0
+// ROWS is used when there is only a limit.
+func (m *MSSQL) LimitAndOffsetSQL(limit, offset interface{}) (sql string) {
+	var parsedOffset, parsedLimit int64 = 0, -1
+	if offset != nil {
+		if v, err := strconv.ParseInt(fmt.Sprint(offset), 0, 0); err == nil && v > 0 {
+			parsedOffset = v
+		}
+	}
+	if limit != nil {
+		if v, err := strconv.ParseInt(fmt.Sprint(limit), 0, 0); err == nil && v >= 0 {
+			parsedLimit = v
+		}
+	}
+	if parsedOffset == 0 && parsedLimit < 0 {
+		return
+	}
+	sql += fmt.Sprintf(" OFFSET %d ROWS", parsedOffset)
+	if parsedLimit >= 0 {
+		sql += fmt.Sprintf(" FETCH NEXT %d ROWS ONLY", parsedLimit)
+	}
+	return
+}
+
+// NeedsOrder returns true, OFFSET and FETCH NEXT are only valid after an ORDER
+// BY clause.
+func (m *MSSQL) NeedsOrder() bool {
+	return true
+}
+
+// SelectFromDummyTable return select values, for most dbs, `SELECT values` just works, mysql needs `SELECT value FROM DUAL`
+func (m *MSSQL) SelectFromDummyTable() string {
+	return ""
+}
+
+// LastInsertIDReturningSuffix returns an empty string, mssql returns the id of
+// the new record with the OUTPUT clause.
+func (m *MSSQL) LastInsertIDReturningSuffix(tableName, columnName string) string {
+	return ""
+}
+
+// LastInsertIDOutputInterstitial returns the OUTPUT INSERTED clause for
+// columnName. mssql doesn't support LastInsertId so the id is read from the
+// result of the INSERT query.
+func (m *MSSQL) LastInsertIDOutputInterstitial(tableName, columnName string, columns []string) string {
+	return "OUTPUT INSERTED." + columnName
+}
+
+// BuildForeignKeyName returns a foreign key name for the given table, field and reference
+func (m *MSSQL) BuildForeignKeyName(tableName, field, dest string) string {
+	keyName := fmt.Sprintf("%s_%s_%s_foreign", tableName, field, dest)
+	keyName = regexes.KeyName.ReplaceAllString(keyName, "_")
+	return keyName
+}
+
+// CreateIndexSQL implements dialects.IndexCreator. mssql supports sort orders
+// and filtered indexes, but not index methods or expressions.
+func (m *MSSQL) CreateIndexSQL(tableName string, index *model.Index) (string, error) {
+	err := dialects.CheckIndex(m, index, dialects.IndexOptions{
+		Sort: true, Where: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	sql := fmt.Sprintf("%s %v ON %v(%v)", dialects.CreateIndex(index), index.Name,
+		tableName, dialects.IndexColumns(m, index))
+	if index.Where != "" {
+		sql += " WHERE " + index.Where
+	}
+	return sql, nil
+}
+
+// ForeignKeySQL implements dialects.ForeignKeyer. mssql has no RESTRICT
+// action, NO ACTION is its equivalent.
+func (m *MSSQL) ForeignKeySQL(fk *model.ForeignKey) (string, error) {
+	return dialects.ForeignKeySQL(m, fk, "CASCADE", "SET NULL", "SET DEFAULT", "NO ACTION")
+}
+
+// InlineForeignKeys implements dialects.ForeignKeyer.
+func (m *MSSQL) InlineForeignKeys() bool {
+	return false
+}
+
+// CurrentDatabase return current database name
+func (m *MSSQL) CurrentDatabase() string {
+	var name string
+	err := m.db.QueryRowContext(m.ctx, "SELECT DB_NAME()").Scan(&name)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+//QueryFieldName returns prefix for field names if name. For instance users.id
+//to point to users id field.
+func (m *MSSQL) QueryFieldName(name string) string {
+	return name + "."
+}
+
+// SavePoint returns the sql for creating a savepoint.
+func (m *MSSQL) SavePoint(name string) string {
+	return "SAVE TRANSACTION " + m.Quote(name)
+}
+
+// RollbackToSavePoint returns the sql for rolling back to a savepoint.
+func (m *MSSQL) RollbackToSavePoint(name string) string {
+	return "ROLLBACK TRANSACTION " + m.Quote(name)
+}
+
+// ReleaseSavePoint returns an empty string, mssql savepoints are released when
+// the transaction ends.
+func (m *MSSQL) ReleaseSavePoint(name string) string {
+	return ""
+}
@@ -0,0 +1,124 @@
+package mssql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gernest/ngorm/fixture"
+	"github.com/gernest/ngorm/model"
+)
+
+func TestDialect(t *testing.T) {
+	rec, db := fixture.NewRecorder()
+	defer func() { _ = db.Close() }()
+	rec.Reply("INFORMATION_SCHEMA.TABLES", []string{"count"}, []interface{}{int64(1)})
+	rec.Reply("SELECT DB_NAME()", []string{"name"}, []interface{}{"ngorm"})
+
+	dialect := New()
+	if dialect.GetName() != "mssql" {
+		t.Errorf("expected mssql got %s", dialect.GetName())
+	}
+	dialect.SetDB(db)
+	if !dialect.HasTable("users") {
+		t.Error("expected to be true")
+	}
+	expect := "SELECT count(*) FROM INFORMATION_SCHEMA.TABLES WHERE table_catalog = DB_NAME() AND table_name = @p1"
+	if q := rec.Last(); q.SQL != expect {
+		t.Errorf("expected %s got %s", expect, q.SQL)
+	}
+	if dialect.HasColumn("users", "name") {
+		t.Error("expected to be false")
+	}
+	if dialect.HasIndex("users", "idx_users_name") {
+		t.Error("expected to be false")
+	}
+	err := dialect.RemoveIndex("users", "idx_users_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "DROP INDEX [idx_users_name] ON [users]"
+	if q := rec.Last(); q.SQL != expect {
+		t.Errorf("expected %s got %s", expect, q.SQL)
+	}
+	if name := dialect.CurrentDatabase(); name != "ngorm" {
+		t.Errorf("expected ngorm got %s", name)
+	}
+}
+
+func TestMSSQL_DataTypeOf(t *testing.T) {
+	m := New()
+	sample := []struct {
+		value  interface{}
+		tags   map[string]string
+		pk     bool
+		expect string
+	}{
+		{true, nil, false, "bit"},
+		{int(1), nil, true, "int IDENTITY(1,1)"},
+		{int(1), nil, false, "int"},
+		{int64(1), nil, true, "bigint IDENTITY(1,1)"},
+		{1.5, nil, false, "float"},
+		{"", nil, false, "nvarchar(255)"},
+		{"", map[string]string{"SIZE": "8000"}, false, "nvarchar(max)"},
+		{time.Time{}, nil, false, "datetimeoffset"},
+		{[]byte{}, nil, false, "varbinary(255)"},
+		{[]byte{}, map[string]string{"SIZE": "9000"}, false, "varbinary(max)"},
+	}
+	for _, v := range sample {
+		tags := make(map[string]string)
+		for k, val := range v.tags {
+			tags[k] = val
+		}
+		field := &model.StructField{
+			Struct:       reflect.StructField{Type: reflect.TypeOf(v.value)},
+			IsPrimaryKey: v.pk,
+			TagSettings:  tags,
+		}
+		typ, err := m.DataTypeOf(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != v.expect {
+			t.Errorf("expected %s got %s", v.expect, typ)
+		}
+	}
+}
+
+func TestMSSQL_LimitAndOffsetSQL(t *testing.T) {
+	m := New()
+	sample := []struct {
+		limit, offset interface{}
+		expect        string
+	}{
+		{nil, nil, ""},
+		{10, nil, " OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY"},
+		{nil, 5, " OFFSET 5 ROWS"},
+		{10, 5, " OFFSET 5 ROWS FETCH NEXT 10 ROWS ONLY"},
+		{-1, -1, ""},
+	}
+	for _, v := range sample {
+		s := m.LimitAndOffsetSQL(v.limit, v.offset)
+		if s != v.expect {
+			t.Errorf("expected %q got %q", v.expect, s)
+		}
+	}
+	if !m.NeedsOrder() {
+		t.Error("expected to be true")
+	}
+}
+
+func TestMSSQL_Quote(t *testing.T) {
+	m := New()
+	expect := "[quote]"
+	if v := m.Quote("quote"); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	if v := m.BindVar(2); v != "@p2" {
+		t.Errorf("expected @p2 got %s", v)
+	}
+	expect = "OUTPUT INSERTED.[id]"
+	if v := m.LastInsertIDOutputInterstitial("users", "[id]", nil); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+}
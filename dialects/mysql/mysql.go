@@ -0,0 +1,391 @@
+// Package mysql exposes implementations and functions that enables ngorm to
+// work with mysql database.
+package mysql
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gernest/ngorm/dialects"
+	"github.com/gernest/ngorm/model"
+	"github.com/gernest/ngorm/regexes"
+)
+
+// maxKeyLength is the maximum length of identifiers in mysql.
+const maxKeyLength = 64
+
+//MySQL implements the dialects.Dialect interface that uses mysql as the SQL
+//backend.
+type MySQL struct {
+	db  model.SQLCommon
+	ctx context.Context
+}
+
+func init() {
+	dialects.Register("mysql", func() dialects.Dialect { return New() })
+}
+
+// New returns the dialect for mysql database.
+func New() *MySQL {
+	return &MySQL{ctx: context.Background()}
+}
+
+// GetName get dialect's name
+func (m *MySQL) GetName() string {
+	return "mysql"
+}
+
+// SetDB set db for dialect
+func (m *MySQL) SetDB(db model.SQLCommon) {
+	m.db = db
+}
+
+// SetContext sets the context used by the queries executed by the dialect.
+func (m *MySQL) SetContext(ctx context.Context) {
+	m.ctx = ctx
+}
+
+// BindVar return the placeholder for actual values in SQL statements, mysql
+// uses ?
+func (m *MySQL) BindVar(i int) string {
+	return "?"
+}
+
+// Quote quotes field name to avoid SQL parsing exceptions by using a reserved word as a field name
+func (m *MySQL) Quote(key string) string {
+	return fmt.Sprintf("`%s`", key)
+}
+
+//PrimaryKey implements dialects.Dialect interface. It returns the PRIMARY KEY
+//clause for the keys.
+func (m *MySQL) PrimaryKey(keys []string) string {
+	return fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(keys, ","))
+}
+
+// DataTypeOf return data's sql type
+//
+// The SIZE tag decides between varchar and longtext for strings, and between
+// varbinary and longblob for []byte.
+func (m *MySQL) DataTypeOf(field *model.StructField) (string, error) {
+	var dataValue, sqlType, size, additionalType = dialects.ParseFieldStructForDialect(field)
+	if sqlType == "" {
+		switch dataValue.Kind() {
+		case reflect.Bool:
+			sqlType = "boolean"
+		case reflect.Int8:
+			sqlType = m.autoIncrement(field, "tinyint")
+		case reflect.Int, reflect.Int16, reflect.Int32:
+			sqlType = m.autoIncrement(field, "int")
+		case reflect.Uint8:
+			sqlType = m.autoIncrement(field, "tinyint unsigned")
+		case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uintptr:
+			sqlType = m.autoIncrement(field, "int unsigned")
+		case reflect.Int64:
+			sqlType = m.autoIncrement(field, "bigint")
+		case reflect.Uint64:
+			sqlType = m.autoIncrement(field, "bigint unsigned")
+		case reflect.Float32, reflect.Float64:
+			sqlType = "double"
+		case reflect.String:
+			if size > 0 && size < 65532 {
+				sqlType = fmt.Sprintf("varchar(%d)", size)
+			} else {
+				sqlType = "longtext"
+			}
+		case reflect.Struct:
+			if _, ok := dataValue.Interface().(time.Time); ok {
+				if _, ok := field.TagSettings["NOT NULL"]; ok || field.IsPrimaryKey {
+					sqlType = "timestamp"
+				} else {
+					sqlType = "timestamp NULL"
+				}
+			}
+		default:
+			if _, ok := dataValue.Interface().([]byte); ok {
+				if size > 0 && size < 65532 {
+					sqlType = fmt.Sprintf("varbinary(%d)", size)
+				} else {
+					sqlType = "longblob"
+				}
+			}
+		}
+	}
+	if sqlType == "" {
+		return "", fmt.Errorf("invalid sql type %s (%s) for mysql", dataValue.Type().Name(), dataValue.Kind().String())
+	}
+
+	if strings.TrimSpace(additionalType) == "" {
+		return sqlType, nil
+	}
+	return fmt.Sprintf("%v %v", sqlType, additionalType), nil
+}
+
+func (m *MySQL) autoIncrement(field *model.StructField, sqlType string) string {
+	if dialects.FieldCanAutoIncrement(field) {
+		field.TagSettings["AUTO_INCREMENT"] = "AUTO_INCREMENT"
+		return sqlType + " AUTO_INCREMENT"
+	}
+	return sqlType
+}
+
+// HasIndex check has index or not
+func (m *MySQL) HasIndex(tableName string, indexName string) bool {
+	query := "SELECT count(*) FROM INFORMATION_SCHEMA.STATISTICS WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?"
+	var count int
+	err := m.db.QueryRowContext(m.ctx, query, tableName, indexName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// HasForeignKey check has foreign key or not
+func (m *MySQL) HasForeignKey(tableName string, foreignKeyName string) bool {
+	query := "SELECT count(*) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS WHERE constraint_schema = DATABASE() AND table_name = ? AND constraint_name = ? AND constraint_type = 'FOREIGN KEY'"
+	var count int
+	err := m.db.QueryRowContext(m.ctx, query, tableName, foreignKeyName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// RemoveIndex remove index
+func (m *MySQL) RemoveIndex(tableName string, indexName string) error {
+	_, err := m.db.ExecContext(m.ctx, fmt.Sprintf("DROP INDEX %v ON %v", m.Quote(indexName), m.Quote(tableName)))
+	return err
+}
+
+// HasTable check has table or not
+func (m *MySQL) HasTable(tableName string) bool {
+	query := "SELECT count(*) FROM INFORMATION_SCHEMA.TABLES WHERE table_schema = DATABASE() AND table_name = ?"
+	var count int
+	err := m.db.QueryRowContext(m.ctx, query, tableName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// HasColumn check has column or not
+func (m *MySQL) HasColumn(tableName string, columnName string) bool {
+	query := "SELECT count(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?"
+	var count int
+	err := m.db.QueryRowContext(m.ctx, query, tableName, columnName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// Columns returns the columns of the table from INFORMATION_SCHEMA.COLUMNS.
+func (m *MySQL) Columns(tableName string) ([]model.Column, error) {
+	query := "SELECT column_name, column_type, is_nullable = 'YES', column_default FROM INFORMATION_SCHEMA.COLUMNS WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position"
+	rows, err := m.db.QueryContext(m.ctx, query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var columns []model.Column
+	for rows.Next() {
+		var (
+			c   model.Column
+			def sql.NullString
+		)
+		err = rows.Scan(&c.Name, &c.Type, &c.Nullable, &def)
+		if err != nil {
+			return nil, err
+		}
+		c.Default, c.HasDefault = def.String, def.Valid
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// Indexes returns the indexes of the table from INFORMATION_SCHEMA.STATISTICS.
+// The indexes that InnoDB creates for the foreign key constraints are left
+// out, they are named after the constraint.
+func (m *MySQL) Indexes(tableName string) ([]model.Index, error) {
+	query := "SELECT index_name, column_name, non_unique = 0 FROM INFORMATION_SCHEMA.STATISTICS WHERE table_schema = DATABASE() AND table_name = ? AND index_name != 'PRIMARY' AND index_name NOT IN (SELECT constraint_name FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS WHERE constraint_schema = DATABASE() AND table_name = ? AND constraint_type = 'FOREIGN KEY') ORDER BY index_name, seq_in_index"
+	rows, err := m.db.QueryContext(m.ctx, query, tableName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return dialects.ScanIndexes(rows)
+}
+
+// AlterColumnSQL implements dialects.ColumnAlterer with MODIFY COLUMN, which
+// redefines the whole column.
+func (m *MySQL) AlterColumnSQL(tableName string, from, to model.Column) string {
+	sql := fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", tableName, m.Quote(to.Name), to.Type)
+	if !to.Nullable {
+		sql += " NOT NULL"
+	}
+	if to.HasDefault {
+		sql += " DEFAULT " + to.Default
+	}
+	return sql
+}
+
+// DropIndexSQL implements dialects.IndexDropper.
+func (m *MySQL) DropIndexSQL(tableName, indexName string) string {
+	return fmt.Sprintf("DROP INDEX %v ON %v", m.Quote(indexName), m.Quote(tableName))
+}
+
+// LimitAndOffsetSQL return generated SQL with Limit and Offset. mysql only
+// accepts OFFSET after LIMIT, so the largest possible limit is used when there
+// is only an offset.
+func (m *MySQL) LimitAndOffsetSQL(limit, offset interface{}) (sql string) {
+	var hasLimit bool
+	if limit != nil {
+		if parsedLimit, err := strconv.ParseInt(fmt.Sprint(limit), 0, 0); err == nil && parsedLimit >= 0 {
+			sql += fmt.Sprintf(" LIMIT %d", parsedLimit)
+			hasLimit = true
+		}
+	}
+	if offset != nil {
+		if parsedOffset, err := strconv.ParseInt(fmt.Sprint(offset), 0, 0); err == nil && parsedOffset > 0 {
+			if !hasLimit {
+				sql += " LIMIT 18446744073709551615"
+			}
+			sql += fmt.Sprintf(" OFFSET %d", parsedOffset)
+		}
+	}
+	return
+}
+
+// SelectFromDummyTable returns FROM DUAL, mysql needs it to select values
+// without a table.
+func (m *MySQL) SelectFromDummyTable() string {
+	return "FROM DUAL"
+}
+
+// LastInsertIDReturningSuffix returns an empty string, mysql supports
+// LastInsertId.
+func (m *MySQL) LastInsertIDReturningSuffix(tableName, columnName string) string {
+	return ""
+}
+
+// OnConflictSQL implements dialects.Upserter with ON DUPLICATE KEY UPDATE.
+// mysql uses any unique index that conflicts, so columns are only used to
+// leave the row as it is when updates is empty. An empty string is returned
+// when both are empty, there is no column to set.
+func (m *MySQL) OnConflictSQL(columns, updates []string) string {
+	var sets []string
+	for _, column := range updates {
+		sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", column, column))
+	}
+	if len(sets) == 0 && len(columns) > 0 {
+		sets = append(sets, fmt.Sprintf("%s = %s", columns[0], columns[0]))
+	}
+	if len(sets) == 0 {
+		return ""
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+}
+
+// MaxBindVars implements dialects.BatchInserter.
+func (m *MySQL) MaxBindVars() int {
+	return 65535
+}
+
+// FirstInsertID implements dialects.BatchInserter. LAST_INSERT_ID is the id of
+// the first row inserted by the statement, the ids of the rows are consecutive
+// unless innodb_autoinc_lock_mode is set to interleaved.
+func (m *MySQL) FirstInsertID(lastInsertID, n int64) (int64, bool) {
+	return lastInsertID, true
+}
+
+// LastInsertIDOutputInterstitial returns an empty string, the OUTPUT clause is
+// only used by mssql.
+func (m *MySQL) LastInsertIDOutputInterstitial(tableName, columnName string, columns []string) string {
+	return ""
+}
+
+// BuildForeignKeyName returns a foreign key name for the given table, field and
+// reference.
+//
+// mysql identifiers can't be longer than 64 characters, longer names are
+// replaced by the first 24 characters of dest followed by the sha1 sum of the
+// name.
+func (m *MySQL) BuildForeignKeyName(tableName, field, dest string) string {
+	keyName := fmt.Sprintf("%s_%s_%s_foreign", tableName, field, dest)
+	keyName = regexes.KeyName.ReplaceAllString(keyName, "_")
+	if utf8.RuneCountInString(keyName) <= maxKeyLength {
+		return keyName
+	}
+	sum := sha1.Sum([]byte(keyName))
+	destRunes := []rune(regexes.KeyName.ReplaceAllString(dest, "_"))
+	if len(destRunes) > 24 {
+		destRunes = destRunes[:24]
+	}
+	return fmt.Sprintf("%s%x", string(destRunes), sum)
+}
+
+// CreateIndexSQL implements dialects.IndexCreator. mysql has no partial
+// indexes, the sort orders and the expressions need mysql 8.
+func (m *MySQL) CreateIndexSQL(tableName string, index *model.Index) (string, error) {
+	err := dialects.CheckIndex(m, index, dialects.IndexOptions{
+		Sort: true, Expression: true,
+		Types: []string{"BTREE", "HASH"},
+	})
+	if err != nil {
+		return "", err
+	}
+	sql := fmt.Sprintf("%s %v ON %v(%v)", dialects.CreateIndex(index), index.Name,
+		tableName, dialects.IndexColumns(m, index))
+	if index.Type != "" {
+		sql += " USING " + strings.ToUpper(index.Type)
+	}
+	return sql, nil
+}
+
+// ForeignKeySQL implements dialects.ForeignKeyer. InnoDB rejects SET DEFAULT.
+func (m *MySQL) ForeignKeySQL(fk *model.ForeignKey) (string, error) {
+	return dialects.ForeignKeySQL(m, fk, "CASCADE", "SET NULL", "RESTRICT", "NO ACTION")
+}
+
+// InlineForeignKeys implements dialects.ForeignKeyer.
+func (m *MySQL) InlineForeignKeys() bool {
+	return false
+}
+
+// CurrentDatabase return current database name
+func (m *MySQL) CurrentDatabase() string {
+	var name string
+	err := m.db.QueryRowContext(m.ctx, "SELECT DATABASE()").Scan(&name)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+//QueryFieldName returns prefix for field names if name. For instance users.id
+//to point to users id field.
+func (m *MySQL) QueryFieldName(name string) string {
+	return name + "."
+}
+
+// SavePoint returns the sql for creating a savepoint.
+func (m *MySQL) SavePoint(name string) string {
+	return "SAVEPOINT " + m.Quote(name)
+}
+
+// RollbackToSavePoint returns the sql for rolling back to a savepoint.
+func (m *MySQL) RollbackToSavePoint(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + m.Quote(name)
+}
+
+// ReleaseSavePoint returns the sql for releasing a savepoint.
+func (m *MySQL) ReleaseSavePoint(name string) string {
+	return "RELEASE SAVEPOINT " + m.Quote(name)
+}
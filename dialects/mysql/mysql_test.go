@@ -0,0 +1,237 @@
+package mysql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gernest/ngorm/dialects"
+	"github.com/gernest/ngorm/fixture"
+	"github.com/gernest/ngorm/model"
+	"github.com/gernest/ngorm/scope"
+)
+
+func TestDialect(t *testing.T) {
+	rec, db := fixture.NewRecorder()
+	defer func() { _ = db.Close() }()
+	rec.Reply("INFORMATION_SCHEMA.TABLES", []string{"count"}, []interface{}{int64(1)})
+	rec.Reply("SELECT DATABASE()", []string{"database"}, []interface{}{"ngorm"})
+
+	dialect := New()
+	if dialect.GetName() != "mysql" {
+		t.Errorf("expected mysql got %s", dialect.GetName())
+	}
+	dialect.SetDB(db)
+	if !dialect.HasTable("users") {
+		t.Error("expected to be true")
+	}
+	expect := "SELECT count(*) FROM INFORMATION_SCHEMA.TABLES WHERE table_schema = DATABASE() AND table_name = ?"
+	if q := rec.Last(); q.SQL != expect {
+		t.Errorf("expected %s got %s", expect, q.SQL)
+	}
+	if dialect.HasColumn("users", "name") {
+		t.Error("expected to be false")
+	}
+	if dialect.HasIndex("users", "idx_users_name") {
+		t.Error("expected to be false")
+	}
+	err := dialect.RemoveIndex("users", "idx_users_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "DROP INDEX `idx_users_name` ON `users`"
+	if q := rec.Last(); q.SQL != expect {
+		t.Errorf("expected %s got %s", expect, q.SQL)
+	}
+	if name := dialect.CurrentDatabase(); name != "ngorm" {
+		t.Errorf("expected ngorm got %s", name)
+	}
+}
+
+func TestMySQL_Indexes(t *testing.T) {
+	rec, db := fixture.NewRecorder()
+	defer func() { _ = db.Close() }()
+	rec.Reply("INFORMATION_SCHEMA.STATISTICS", []string{"index_name", "column_name", "unique"},
+		[]interface{}{"idx_posts_title", "title", int64(0)},
+	)
+	dialect := New()
+	dialect.SetDB(db)
+	indexes, err := dialect.Indexes("posts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 1 || indexes[0].Name != "idx_posts_title" {
+		t.Errorf("expected idx_posts_title got %v", indexes)
+	}
+	// the indexes backing the foreign keys are filtered out by the query
+	q := rec.Last()
+	if !strings.Contains(q.SQL, "index_name NOT IN (SELECT constraint_name FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS") {
+		t.Errorf("expected the foreign key indexes to be left out got %s", q.SQL)
+	}
+	if !reflect.DeepEqual(q.Args, []interface{}{"posts", "posts"}) {
+		t.Errorf("expected the table name twice got %v", q.Args)
+	}
+}
+
+func TestMySQL_DataTypeOf(t *testing.T) {
+	m := New()
+	sample := []struct {
+		value  interface{}
+		tags   map[string]string
+		pk     bool
+		expect string
+	}{
+		{true, nil, false, "boolean"},
+		{int8(1), nil, false, "tinyint"},
+		{int(1), nil, true, "int AUTO_INCREMENT"},
+		{uint(1), nil, false, "int unsigned"},
+		{int64(1), nil, true, "bigint AUTO_INCREMENT"},
+		{uint64(1), nil, false, "bigint unsigned"},
+		{1.5, nil, false, "double"},
+		{"", nil, false, "varchar(255)"},
+		{"", map[string]string{"SIZE": "100"}, false, "varchar(100)"},
+		{"", map[string]string{"SIZE": "65532"}, false, "longtext"},
+		{time.Time{}, nil, false, "timestamp NULL"},
+		{time.Time{}, map[string]string{"NOT NULL": "NOT NULL"}, false, "timestamp NOT NULL"},
+		{[]byte{}, nil, false, "varbinary(255)"},
+		{[]byte{}, map[string]string{"SIZE": "70000"}, false, "longblob"},
+	}
+	for _, v := range sample {
+		tags := make(map[string]string)
+		for k, val := range v.tags {
+			tags[k] = val
+		}
+		field := &model.StructField{
+			Struct:       reflect.StructField{Type: reflect.TypeOf(v.value)},
+			IsPrimaryKey: v.pk,
+			TagSettings:  tags,
+		}
+		typ, err := m.DataTypeOf(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != v.expect {
+			t.Errorf("expected %s got %s", v.expect, typ)
+		}
+	}
+}
+
+func TestMySQL_BuildForeignKeyName(t *testing.T) {
+	m := New()
+	e := fixture.TestEngine()
+	e.Dialect = m
+	long := m.BuildForeignKeyName(
+		scope.TableName(e, &fixture.NotSoLongTableName{}),
+		"really_long_thing_id",
+		scope.TableName(e, &fixture.ReallyLongTableNameToTestMySQLNameLengthLimit{})+"(id)")
+	if n := utf8.RuneCountInString(long); n > 64 {
+		t.Errorf("expected at most 64 characters got %d for %s", n, long)
+	}
+	prefix := "really_long_table_name_t"
+	if long[:len(prefix)] != prefix {
+		t.Errorf("expected %s to start with %s", long, prefix)
+	}
+	name := m.BuildForeignKeyName("users", "company_id", "companies(id)")
+	expect := "users_company_id_companies_id_foreign"
+	if name != expect {
+		t.Errorf("expected %s got %s", expect, name)
+	}
+}
+
+func TestMySQL_Quote(t *testing.T) {
+	m := New()
+	expect := "`quote`"
+	if v := m.Quote("quote"); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	if v := m.BindVar(2); v != "?" {
+		t.Errorf("expected ? got %s", v)
+	}
+	if v := m.SelectFromDummyTable(); v != "FROM DUAL" {
+		t.Errorf("expected FROM DUAL got %s", v)
+	}
+	expect = " LIMIT 18446744073709551615 OFFSET 10"
+	if v := m.LimitAndOffsetSQL(nil, 10); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+}
+
+func TestMySQL_OnConflictSQL(t *testing.T) {
+	m := New()
+	expect := "ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)"
+	if v := m.OnConflictSQL([]string{"`email`"}, []string{"`name`"}); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	expect = "ON DUPLICATE KEY UPDATE `email` = `email`"
+	if v := m.OnConflictSQL([]string{"`email`"}, nil); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	if v := m.OnConflictSQL(nil, nil); v != "" {
+		t.Errorf("expected an empty clause got %s", v)
+	}
+}
+
+func TestMySQL_AlterColumnSQL(t *testing.T) {
+	m := New()
+	from := model.Column{Name: "age", Type: "int(11)", Nullable: true}
+	to := model.Column{Name: "age", Type: "bigint", Default: "0", HasDefault: true}
+	expect := "ALTER TABLE `users` MODIFY COLUMN `age` bigint NOT NULL DEFAULT 0"
+	if v := m.AlterColumnSQL("`users`", from, to); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	expect = "DROP INDEX `idx_users_age` ON `users`"
+	if v := dialects.DropIndexSQL(m, "users", "idx_users_age"); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+}
+
+func TestMySQL_ForeignKeySQL(t *testing.T) {
+	m := New()
+	fk := &model.ForeignKey{
+		Name:       "posts_author_id_authors_id_foreign",
+		Table:      "posts",
+		Columns:    []string{"author_id"},
+		RefTable:   "authors",
+		RefColumns: []string{"id"},
+		OnDelete:   "CASCADE",
+	}
+	expect := "CONSTRAINT `posts_author_id_authors_id_foreign` FOREIGN KEY (`author_id`) REFERENCES `authors`(`id`) ON DELETE CASCADE"
+	v, err := m.ForeignKeySQL(fk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	fk.OnUpdate = "SET DEFAULT"
+	_, err = m.ForeignKeySQL(fk)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestMySQL_CreateIndexSQL(t *testing.T) {
+	m := New()
+	index := &model.Index{
+		Name:    "idx_users_name_age",
+		Unique:  true,
+		Columns: []string{"name", "age"},
+		Sorts:   []string{"", "DESC"},
+		Type:    "hash",
+	}
+	expect := "CREATE UNIQUE INDEX idx_users_name_age ON `users`(`name`, `age` DESC) USING HASH"
+	v, err := m.CreateIndexSQL("`users`", index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	index.Where = "age > 18"
+	_, err = m.CreateIndexSQL("`users`", index)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
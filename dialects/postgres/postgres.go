@@ -0,0 +1,388 @@
+// Package postgres exposes implementations and functions that enables ngorm to
+// work with postgresql database.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gernest/ngorm/dialects"
+	"github.com/gernest/ngorm/model"
+	"github.com/gernest/ngorm/regexes"
+)
+
+//Postgres implements the dialects.Dialect interface that uses postgresql as
+//the SQL backend.
+//
+// Tables, columns and indexes are looked up in the current schema.
+type Postgres struct {
+	db  model.SQLCommon
+	ctx context.Context
+}
+
+func init() {
+	dialects.Register("postgres", func() dialects.Dialect { return New() })
+}
+
+// New returns the dialect for postgresql database.
+func New() *Postgres {
+	return &Postgres{ctx: context.Background()}
+}
+
+// GetName get dialect's name
+func (p *Postgres) GetName() string {
+	return "postgres"
+}
+
+// SetDB set db for dialect
+func (p *Postgres) SetDB(db model.SQLCommon) {
+	p.db = db
+}
+
+// SetContext sets the context used by the queries executed by the dialect.
+func (p *Postgres) SetContext(ctx context.Context) {
+	p.ctx = ctx
+}
+
+// BindVar return the placeholder for actual values in SQL statements, postgres
+// uses $1, $2 ...
+func (p *Postgres) BindVar(i int) string {
+	return fmt.Sprintf("$%d", i)
+}
+
+// Quote quotes field name to avoid SQL parsing exceptions by using a reserved word as a field name
+func (p *Postgres) Quote(key string) string {
+	return fmt.Sprintf(`"%s"`, key)
+}
+
+//PrimaryKey implements dialects.Dialect interface. It returns the PRIMARY KEY
+//clause for the keys.
+func (p *Postgres) PrimaryKey(keys []string) string {
+	return fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(keys, ","))
+}
+
+// DataTypeOf return data's sql type
+//
+// Integer fields that are auto incremented, primary keys by default, are
+// mapped to serial or bigserial.
+func (p *Postgres) DataTypeOf(field *model.StructField) (string, error) {
+	var dataValue, sqlType, size, additionalType = dialects.ParseFieldStructForDialect(field)
+	if sqlType == "" {
+		switch dataValue.Kind() {
+		case reflect.Bool:
+			sqlType = "boolean"
+		case reflect.Int,
+			reflect.Int8,
+			reflect.Int16,
+			reflect.Int32,
+			reflect.Uint,
+			reflect.Uint8,
+			reflect.Uint16,
+			reflect.Uint32,
+			reflect.Uintptr:
+			if dialects.FieldCanAutoIncrement(field) {
+				field.TagSettings["AUTO_INCREMENT"] = "AUTO_INCREMENT"
+				sqlType = "serial"
+			} else {
+				sqlType = "integer"
+			}
+		case reflect.Int64, reflect.Uint64:
+			if dialects.FieldCanAutoIncrement(field) {
+				field.TagSettings["AUTO_INCREMENT"] = "AUTO_INCREMENT"
+				sqlType = "bigserial"
+			} else {
+				sqlType = "bigint"
+			}
+		case reflect.Float32, reflect.Float64:
+			sqlType = "numeric"
+		case reflect.String:
+			if size > 0 && size < 65532 {
+				sqlType = fmt.Sprintf("varchar(%d)", size)
+			} else {
+				sqlType = "text"
+			}
+		case reflect.Struct:
+			if _, ok := dataValue.Interface().(time.Time); ok {
+				sqlType = "timestamp with time zone"
+			}
+		default:
+			if _, ok := dataValue.Interface().([]byte); ok {
+				sqlType = "bytea"
+			}
+		}
+	}
+	if sqlType == "" {
+		return "", fmt.Errorf("invalid sql type %s (%s) for postgres", dataValue.Type().Name(), dataValue.Kind().String())
+	}
+
+	if strings.TrimSpace(additionalType) == "" {
+		return sqlType, nil
+	}
+	return fmt.Sprintf("%v %v", sqlType, additionalType), nil
+}
+
+// HasIndex check has index or not. Indexes are not part of information_schema
+// so pg_indexes is used instead.
+func (p *Postgres) HasIndex(tableName string, indexName string) bool {
+	query := "SELECT count(*) FROM pg_indexes WHERE schemaname = CURRENT_SCHEMA() AND tablename = $1 AND indexname = $2"
+	var count int
+	err := p.db.QueryRowContext(p.ctx, query, tableName, indexName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// HasForeignKey check has foreign key or not
+func (p *Postgres) HasForeignKey(tableName string, foreignKeyName string) bool {
+	query := "SELECT count(*) FROM information_schema.table_constraints WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1 AND constraint_name = $2 AND constraint_type = 'FOREIGN KEY'"
+	var count int
+	err := p.db.QueryRowContext(p.ctx, query, tableName, foreignKeyName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// RemoveIndex remove index
+func (p *Postgres) RemoveIndex(tableName string, indexName string) error {
+	_, err := p.db.ExecContext(p.ctx, fmt.Sprintf("DROP INDEX %v", p.Quote(indexName)))
+	return err
+}
+
+// HasTable check has table or not
+func (p *Postgres) HasTable(tableName string) bool {
+	query := "SELECT count(*) FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1 AND table_type = 'BASE TABLE'"
+	var count int
+	err := p.db.QueryRowContext(p.ctx, query, tableName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// HasColumn check has column or not
+func (p *Postgres) HasColumn(tableName string, columnName string) bool {
+	query := "SELECT count(*) FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1 AND column_name = $2"
+	var count int
+	err := p.db.QueryRowContext(p.ctx, query, tableName, columnName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// Columns returns the columns of the table from pg_attribute. The types are
+// the ones of format_type, with character varying shortened to varchar.
+func (p *Postgres) Columns(tableName string) ([]model.Column, error) {
+	query := `SELECT a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull, pg_get_expr(d.adbin, d.adrelid)
+	FROM pg_attribute a
+	JOIN pg_class c ON c.oid = a.attrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+	WHERE n.nspname = CURRENT_SCHEMA() AND c.relname = $1 AND a.attnum > 0 AND NOT a.attisdropped
+	ORDER BY a.attnum`
+	rows, err := p.db.QueryContext(p.ctx, query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var columns []model.Column
+	for rows.Next() {
+		var (
+			c   model.Column
+			def sql.NullString
+		)
+		err = rows.Scan(&c.Name, &c.Type, &c.Nullable, &def)
+		if err != nil {
+			return nil, err
+		}
+		c.Type = strings.Replace(c.Type, "character varying", "varchar", 1)
+		c.Default, c.HasDefault = def.String, def.Valid
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// Indexes returns the indexes of the table from pg_index, leaving out the ones
+// backing constraints.
+func (p *Postgres) Indexes(tableName string) ([]model.Index, error) {
+	query := `SELECT i.relname, a.attname, ix.indisunique
+	FROM pg_index ix
+	JOIN pg_class t ON t.oid = ix.indrelid
+	JOIN pg_class i ON i.oid = ix.indexrelid
+	JOIN pg_namespace n ON n.oid = t.relnamespace
+	JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, pos) ON true
+	JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+	WHERE n.nspname = CURRENT_SCHEMA() AND t.relname = $1 AND NOT ix.indisprimary
+	AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = ix.indexrelid)
+	ORDER BY i.relname, k.pos`
+	rows, err := p.db.QueryContext(p.ctx, query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return dialects.ScanIndexes(rows)
+}
+
+// AlterColumnSQL implements dialects.ColumnAlterer with one ALTER COLUMN
+// action for each property of the column that differs.
+func (p *Postgres) AlterColumnSQL(tableName string, from, to model.Column) string {
+	column := p.Quote(to.Name)
+	var actions []string
+	if !dialects.SameType(from.Type, to.Type) {
+		actions = append(actions, fmt.Sprintf("ALTER COLUMN %s TYPE %s USING %s::%s",
+			column, to.Type, column, to.Type))
+	}
+	if from.Nullable != to.Nullable {
+		if to.Nullable {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", column))
+		} else {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", column))
+		}
+	}
+	if from.HasDefault != to.HasDefault || !dialects.SameDefault(from.Default, to.Default) {
+		if to.HasDefault {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %s", column, to.Default))
+		} else {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", column))
+		}
+	}
+	if len(actions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("ALTER TABLE %s %s", tableName, strings.Join(actions, ", "))
+}
+
+// LimitAndOffsetSQL return generated SQL with Limit and Offset
+func (p *Postgres) LimitAndOffsetSQL(limit, offset interface{}) (sql string) {
+	if limit != nil {
+		if parsedLimit, err := strconv.ParseInt(fmt.Sprint(limit), 0, 0); err == nil && parsedLimit >= 0 {
+			sql += fmt.Sprintf(" LIMIT %d", parsedLimit)
+		}
+	}
+	if offset != nil {
+		if parsedOffset, err := strconv.ParseInt(fmt.Sprint(offset), 0, 0); err == nil && parsedOffset > 0 {
+			sql += fmt.Sprintf(" OFFSET %d", parsedOffset)
+		}
+	}
+	return
+}
+
+// SelectFromDummyTable return select values, for most dbs, `SELECT values` just works, mysql needs `SELECT value FROM DUAL`
+func (p *Postgres) SelectFromDummyTable() string {
+	return ""
+}
+
+// LastInsertIDReturningSuffix returns the RETURNING clause for columnName.
+// postgres doesn't support LastInsertId so the id is read from the result of
+// the INSERT query.
+func (p *Postgres) LastInsertIDReturningSuffix(tableName, columnName string) string {
+	return "RETURNING " + columnName
+}
+
+// OnConflictSQL implements dialects.Upserter with ON CONFLICT ... DO UPDATE,
+// the inserted values are referenced with the excluded table.
+func (p *Postgres) OnConflictSQL(columns, updates []string) string {
+	if len(updates) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(columns, ","))
+	}
+	var sets []string
+	for _, column := range updates {
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", column, column))
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s",
+		strings.Join(columns, ","), strings.Join(sets, ","))
+}
+
+// MaxBindVars implements dialects.BatchInserter.
+func (p *Postgres) MaxBindVars() int {
+	return 65535
+}
+
+// FirstInsertID implements dialects.BatchInserter, the keys are returned by
+// the INSERT statement instead.
+func (p *Postgres) FirstInsertID(lastInsertID, n int64) (int64, bool) {
+	return 0, false
+}
+
+// LastInsertIDOutputInterstitial returns an empty string, the OUTPUT clause is
+// only used by mssql.
+func (p *Postgres) LastInsertIDOutputInterstitial(tableName, columnName string, columns []string) string {
+	return ""
+}
+
+// BuildForeignKeyName returns a foreign key name for the given table, field and reference
+func (p *Postgres) BuildForeignKeyName(tableName, field, dest string) string {
+	keyName := fmt.Sprintf("%s_%s_%s_foreign", tableName, field, dest)
+	keyName = regexes.KeyName.ReplaceAllString(keyName, "_")
+	return keyName
+}
+
+// CreateIndexSQL implements dialects.IndexCreator with all the options, the
+// index method is one of the built in ones.
+func (p *Postgres) CreateIndexSQL(tableName string, index *model.Index) (string, error) {
+	err := dialects.CheckIndex(p, index, dialects.IndexOptions{
+		Sort: true, Where: true, Expression: true,
+		Types: []string{"btree", "hash", "gist", "spgist", "gin", "brin"},
+	})
+	if err != nil {
+		return "", err
+	}
+	sql := fmt.Sprintf("%s %v ON %v", dialects.CreateIndex(index), index.Name, tableName)
+	if index.Type != "" {
+		sql += " USING " + strings.ToLower(index.Type)
+	}
+	sql += fmt.Sprintf("(%v)", dialects.IndexColumns(p, index))
+	if index.Where != "" {
+		sql += " WHERE " + index.Where
+	}
+	return sql, nil
+}
+
+// ForeignKeySQL implements dialects.ForeignKeyer.
+func (p *Postgres) ForeignKeySQL(fk *model.ForeignKey) (string, error) {
+	return dialects.ForeignKeySQL(p, fk, dialects.ReferentialActions...)
+}
+
+// InlineForeignKeys implements dialects.ForeignKeyer.
+func (p *Postgres) InlineForeignKeys() bool {
+	return false
+}
+
+// CurrentDatabase return current database name
+func (p *Postgres) CurrentDatabase() string {
+	var name string
+	err := p.db.QueryRowContext(p.ctx, "SELECT CURRENT_DATABASE()").Scan(&name)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+//QueryFieldName returns prefix for field names if name. For instance users.id
+//to point to users id field.
+func (p *Postgres) QueryFieldName(name string) string {
+	return name + "."
+}
+
+// SavePoint returns the sql for creating a savepoint.
+func (p *Postgres) SavePoint(name string) string {
+	return "SAVEPOINT " + p.Quote(name)
+}
+
+// RollbackToSavePoint returns the sql for rolling back to a savepoint.
+func (p *Postgres) RollbackToSavePoint(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + p.Quote(name)
+}
+
+// ReleaseSavePoint returns the sql for releasing a savepoint.
+func (p *Postgres) ReleaseSavePoint(name string) string {
+	return "RELEASE SAVEPOINT " + p.Quote(name)
+}
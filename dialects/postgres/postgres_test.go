@@ -0,0 +1,188 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gernest/ngorm/fixture"
+	"github.com/gernest/ngorm/model"
+)
+
+func TestDialect(t *testing.T) {
+	rec, db := fixture.NewRecorder()
+	defer func() { _ = db.Close() }()
+	rec.Reply("information_schema.tables", []string{"count"}, []interface{}{int64(1)})
+	rec.Reply("pg_indexes", []string{"count"}, []interface{}{int64(1)})
+	rec.Reply("CURRENT_DATABASE()", []string{"current_database"}, []interface{}{"ngorm"})
+
+	dialect := New()
+	if dialect.GetName() != "postgres" {
+		t.Errorf("expected postgres got %s", dialect.GetName())
+	}
+	dialect.SetDB(db)
+
+	sample := []struct {
+		has    func() bool
+		expect bool
+		query  string
+		args   []interface{}
+	}{
+		{
+			func() bool { return dialect.HasTable("users") },
+			true,
+			"SELECT count(*) FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1 AND table_type = 'BASE TABLE'",
+			[]interface{}{"users"},
+		},
+		{
+			func() bool { return dialect.HasColumn("users", "name") },
+			false,
+			"SELECT count(*) FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1 AND column_name = $2",
+			[]interface{}{"users", "name"},
+		},
+		{
+			func() bool { return dialect.HasIndex("users", "idx_users_name") },
+			true,
+			"SELECT count(*) FROM pg_indexes WHERE schemaname = CURRENT_SCHEMA() AND tablename = $1 AND indexname = $2",
+			[]interface{}{"users", "idx_users_name"},
+		},
+		{
+			func() bool { return dialect.HasForeignKey("users", "users_company_id_companies_id_foreign") },
+			false,
+			"SELECT count(*) FROM information_schema.table_constraints WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1 AND constraint_name = $2 AND constraint_type = 'FOREIGN KEY'",
+			[]interface{}{"users", "users_company_id_companies_id_foreign"},
+		},
+	}
+	for _, v := range sample {
+		if v.has() != v.expect {
+			t.Errorf("expected %v for %s", v.expect, v.query)
+		}
+		q := rec.Last()
+		if q.SQL != v.query {
+			t.Errorf("expected %s got %s", v.query, q.SQL)
+		}
+		if !reflect.DeepEqual(q.Args, v.args) {
+			t.Errorf("expected %v got %v", v.args, q.Args)
+		}
+	}
+
+	err := dialect.RemoveIndex("users", "idx_users_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `DROP INDEX "idx_users_name"`
+	if q := rec.Last(); q.SQL != expect {
+		t.Errorf("expected %s got %s", expect, q.SQL)
+	}
+	if name := dialect.CurrentDatabase(); name != "ngorm" {
+		t.Errorf("expected ngorm got %s", name)
+	}
+}
+
+func TestPostgres_DataTypeOf(t *testing.T) {
+	p := New()
+	sample := []struct {
+		value  interface{}
+		tags   map[string]string
+		pk     bool
+		expect string
+	}{
+		{true, nil, false, "boolean"},
+		{int(1), nil, false, "integer"},
+		{int(1), nil, true, "serial"},
+		{uint(1), map[string]string{"AUTO_INCREMENT": "AUTO_INCREMENT"}, false, "serial"},
+		{int64(1), nil, false, "bigint"},
+		{int64(1), nil, true, "bigserial"},
+		{1.5, nil, false, "numeric"},
+		{"", nil, false, "varchar(255)"},
+		{"", map[string]string{"SIZE": "70000"}, false, "text"},
+		{"", map[string]string{"DEFAULT": "'hello'"}, false, "varchar(255) DEFAULT 'hello'"},
+		{time.Time{}, nil, false, "timestamp with time zone"},
+		{[]byte{}, nil, false, "bytea"},
+	}
+	for _, v := range sample {
+		tags := make(map[string]string)
+		for k, val := range v.tags {
+			tags[k] = val
+		}
+		field := &model.StructField{
+			Struct:       reflect.StructField{Type: reflect.TypeOf(v.value)},
+			IsPrimaryKey: v.pk,
+			TagSettings:  tags,
+		}
+		typ, err := p.DataTypeOf(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != v.expect {
+			t.Errorf("expected %s got %s", v.expect, typ)
+		}
+	}
+}
+
+func TestPostgres_Quote(t *testing.T) {
+	p := New()
+	expect := `"quote"`
+	if v := p.Quote("quote"); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	if v := p.BindVar(2); v != "$2" {
+		t.Errorf("expected $2 got %s", v)
+	}
+	expect = `RETURNING "id"`
+	if v := p.LastInsertIDReturningSuffix(`"users"`, `"id"`); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+}
+
+func TestPostgres_OnConflictSQL(t *testing.T) {
+	p := New()
+	expect := `ON CONFLICT ("email") DO UPDATE SET "name" = excluded."name"`
+	if v := p.OnConflictSQL([]string{`"email"`}, []string{`"name"`}); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	expect = `ON CONFLICT ("email") DO NOTHING`
+	if v := p.OnConflictSQL([]string{`"email"`}, nil); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+}
+
+func TestPostgres_AlterColumnSQL(t *testing.T) {
+	p := New()
+	from := model.Column{Name: "name", Type: "varchar(255)", Nullable: true}
+	to := model.Column{Name: "name", Type: "text", Default: "'x'", HasDefault: true}
+	expect := `ALTER TABLE "users" ALTER COLUMN "name" TYPE text USING "name"::text, ALTER COLUMN "name" SET NOT NULL, ALTER COLUMN "name" SET DEFAULT 'x'`
+	if v := p.AlterColumnSQL(`"users"`, from, to); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	from = model.Column{Name: "name", Type: "varchar(255)", Default: "'x'::character varying", HasDefault: true}
+	to = model.Column{Name: "name", Type: "varchar(255)", Nullable: true, Default: "'x'", HasDefault: true}
+	expect = `ALTER TABLE "users" ALTER COLUMN "name" DROP NOT NULL`
+	if v := p.AlterColumnSQL(`"users"`, from, to); v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+}
+
+func TestPostgres_CreateIndexSQL(t *testing.T) {
+	p := New()
+	index := &model.Index{
+		Name:    "idx_users_name_age",
+		Columns: []string{"name", "(lower(email))"},
+		Sorts:   []string{"DESC"},
+		Where:   "deleted_at IS NULL",
+		Type:    "GIN",
+	}
+	expect := `CREATE INDEX idx_users_name_age ON "users" USING gin("name" DESC, (lower(email))) WHERE deleted_at IS NULL`
+	v, err := p.CreateIndexSQL(`"users"`, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	index.Type = "fulltext"
+	_, err = p.CreateIndexSQL(`"users"`, index)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,19 @@
+// Package hooks registers the hooks of the ql and ql-mem dialects with
+// hooks.RegisterDialect.
+//
+// This is a separate package because the hooks package imports the packages
+// whose tests use the ql dialect. It is imported by ngorm.
+package hooks
+
+import (
+	"github.com/gernest/ngorm/hooks"
+	"github.com/gernest/ngorm/model"
+)
+
+func init() {
+	for _, name := range []string{"ql", "ql-mem"} {
+		hooks.RegisterDialect(name, func(b *hooks.Book) {
+			b.Create.Set(hooks.HookFunc(model.AfterCreate, hooks.QLAfterCreate))
+		})
+	}
+}
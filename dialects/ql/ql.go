@@ -6,6 +6,7 @@
 package ql
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -29,18 +30,24 @@ import (
 type QL struct {
 	name string
 	db   model.SQLCommon
+	ctx  context.Context
+}
+
+func init() {
+	dialects.Register("ql", func() dialects.Dialect { return File() })
+	dialects.Register("ql-mem", func() dialects.Dialect { return Memory() })
 }
 
 // Memory returns the dialect for in memory ql database. This is not persistent
 // everything will be lost when the process exits.
 func Memory() *QL {
-	return &QL{name: "ql-mem"}
+	return &QL{name: "ql-mem", ctx: context.Background()}
 }
 
 //File returns the dialcet for file backed ql database. This is the recommended
 //way use the Memory only for testing else you might lose all of your data.
 func File() *QL {
-	return &QL{name: "ql"}
+	return &QL{name: "ql", ctx: context.Background()}
 }
 
 // GetName get dialect's name
@@ -53,6 +60,17 @@ func (q *QL) SetDB(db model.SQLCommon) {
 	q.db = db
 }
 
+// NeedsTX returns true, ql requires all write queries to be wrapped in a
+// transaction block.
+func (q *QL) NeedsTX() bool {
+	return true
+}
+
+// SetContext sets the context used by the queries executed by the dialect.
+func (q *QL) SetContext(ctx context.Context) {
+	q.ctx = ctx
+}
+
 // BindVar return the placeholder for actual values in SQL statements, in many dbs it is "?", Postgres using $1
 func (q QL) BindVar(i int) string {
 	return fmt.Sprintf("$%d", i)
@@ -64,8 +82,8 @@ func (q *QL) Quote(key string) string {
 	return key
 }
 
-//PrimaryKey implements dialects.Dialect interface. This is supposed to return a
-//comma separated string of primary keys.
+//PrimaryKey implements dialects.Dialect interface. This is supposed to return
+//the PRIMARY KEY clause for the keys.
 //
 // ql does not support PRIMARY KEY so no matter how many keys are passed this
 // method will return an empty string.
@@ -122,7 +140,7 @@ func (q *QL) DataTypeOf(field *model.StructField) (string, error) {
 func (q *QL) HasIndex(tableName string, indexName string) bool {
 	querry := "select count() from __Index where Name=$1  && TableName=$2"
 	var count int
-	err := q.db.QueryRow(querry, indexName, tableName).Scan(&count)
+	err := q.db.QueryRowContext(q.ctx, querry, indexName, tableName).Scan(&count)
 	if err != nil {
 		//TODO; Propery log or return this error?
 	}
@@ -136,11 +154,16 @@ func (q *QL) HasForeignKey(tableName string, foreignKeyName string) bool {
 
 // RemoveIndex remove index
 func (q *QL) RemoveIndex(tableName string, indexName string) error {
-	tx, err := q.db.Begin()
+	query := fmt.Sprintf("DROP INDEX %v", indexName)
+	if tx, ok := q.db.(*model.SQLTx); ok {
+		_, err := tx.ExecContext(q.ctx, query)
+		return err
+	}
+	tx, err := q.db.BeginTx(q.ctx, nil)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(fmt.Sprintf("DROP INDEX %v", indexName))
+	_, err = tx.ExecContext(q.ctx, query)
 	if err != nil {
 		return err
 	}
@@ -151,7 +174,7 @@ func (q *QL) RemoveIndex(tableName string, indexName string) error {
 func (q *QL) HasTable(tableName string) bool {
 	querry := "select count() from __Table where Name=$1"
 	var count int
-	err := q.db.QueryRow(querry, tableName).Scan(&count)
+	err := q.db.QueryRowContext(q.ctx, querry, tableName).Scan(&count)
 	if err != nil {
 		//TODO; Propery log or return this error?
 	}
@@ -162,13 +185,79 @@ func (q *QL) HasTable(tableName string) bool {
 func (q *QL) HasColumn(tableName string, columnName string) bool {
 	querry := "select count() from __Column where Name=$1  && TableName=$2"
 	var count int
-	err := q.db.QueryRow(querry, columnName, tableName).Scan(&count)
+	err := q.db.QueryRowContext(q.ctx, querry, columnName, tableName).Scan(&count)
 	if err != nil {
 		//TODO; Propery log or return this error?
 	}
 	return count > 0
 }
 
+// Columns returns the columns of the table from the __Column and __Column2
+// system tables.
+func (q *QL) Columns(tableName string) ([]model.Column, error) {
+	rows, err := q.db.QueryContext(q.ctx,
+		"select Name, Type from __Column where TableName=$1", tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var columns []model.Column
+	for rows.Next() {
+		c := model.Column{Nullable: true}
+		err = rows.Scan(&c.Name, &c.Type)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	// __Column2 only exists once a column has a constraint or a default.
+	if !q.HasTable("__Column2") {
+		return columns, nil
+	}
+	rows2, err := q.db.QueryContext(q.ctx,
+		"select Name, NotNull, DefaultExpr from __Column2 where TableName=$1", tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows2.Close()
+	}()
+	for rows2.Next() {
+		var (
+			name, def string
+			notNull   bool
+		)
+		err = rows2.Scan(&name, &notNull, &def)
+		if err != nil {
+			return nil, err
+		}
+		for i := range columns {
+			if columns[i].Name == name {
+				columns[i].Nullable = !notNull
+				columns[i].Default, columns[i].HasDefault = def, def != ""
+			}
+		}
+	}
+	return columns, rows2.Err()
+}
+
+// Indexes returns the indexes of the table from the __Index system table.
+func (q *QL) Indexes(tableName string) ([]model.Index, error) {
+	rows, err := q.db.QueryContext(q.ctx,
+		"select Name, ColumnName, IsUnique from __Index where TableName=$1 order by Name", tableName)
+	if err != nil {
+		return nil, err
+	}
+	return dialects.ScanIndexes(rows)
+}
+
 // LimitAndOffsetSQL return generated SQL with Limit and Offset, as mssql has special case
 func (q *QL) LimitAndOffsetSQL(limit, offset interface{}) (sql string) {
 	if limit != nil {
@@ -194,6 +283,12 @@ func (q *QL) LastInsertIDReturningSuffix(tableName, columnName string) string {
 	return ""
 }
 
+// LastInsertIDOutputInterstitial returns an empty string, the OUTPUT clause is
+// only used by mssql.
+func (q *QL) LastInsertIDOutputInterstitial(tableName, columnName string, columns []string) string {
+	return ""
+}
+
 // BuildForeignKeyName returns a foreign key name for the given table, field and reference
 func (q *QL) BuildForeignKeyName(tableName, field, dest string) string {
 	keyName := fmt.Sprintf("%s_%s_%s_foreign", tableName, field, dest)
@@ -214,3 +309,22 @@ func (q *QL) CurrentDatabase() string {
 func (q QL) QueryFieldName(name string) string {
 	return ""
 }
+
+// SavePoint returns an empty string, savepoints are not supported.
+//
+// ql has nested transactions which could stand in for savepoints, but changes
+// made by UPDATE statements in a committed nested transaction are kept even
+// when the enclosing transaction is rolled back.
+func (q *QL) SavePoint(name string) string {
+	return ""
+}
+
+// RollbackToSavePoint returns an empty string, savepoints are not supported.
+func (q *QL) RollbackToSavePoint(name string) string {
+	return ""
+}
+
+// ReleaseSavePoint returns an empty string, savepoints are not supported.
+func (q *QL) ReleaseSavePoint(name string) string {
+	return ""
+}
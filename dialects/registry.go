@@ -0,0 +1,56 @@
+package dialects
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Factory returns a new instance of a dialect. Every call must return a fresh
+//value, because the dialect is bound to the database it is opened with.
+type Factory func() Dialect
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+//Register makes a dialect available by the provided name. If Register is called
+//twice with the same name or if factory is nil, it panics.
+//
+// This is modeled after database/sql.Register, dialects are expected to
+// register themselves in the init function of their packages.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic("dialects: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("dialects: Register called twice for dialect " + name)
+	}
+	factories[name] = factory
+}
+
+//Open returns a new instance of the dialect registered by name.
+func Open(name string) (Dialect, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported dialect %s", name)
+	}
+	return factory(), nil
+}
+
+//Dialects returns a sorted list of the names of the registered dialects.
+func Dialects() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	var list []string
+	for name := range factories {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
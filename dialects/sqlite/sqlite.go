@@ -0,0 +1,348 @@
+// Package sqlite exposes implementations and functions that enables ngorm to
+// work with sqlite3 database.
+//
+// The dialect is registered under the name sqlite3, which is also the name of
+// the driver registered by github.com/mattn/go-sqlite3.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gernest/ngorm/dialects"
+	"github.com/gernest/ngorm/model"
+	"github.com/gernest/ngorm/regexes"
+)
+
+//SQLite implements the dialects.Dialect interface that uses sqlite3 database
+//as the SQL backend.
+type SQLite struct {
+	db  model.SQLCommon
+	ctx context.Context
+}
+
+func init() {
+	dialects.Register("sqlite3", func() dialects.Dialect { return New() })
+}
+
+// New returns the dialect for sqlite3 database.
+func New() *SQLite {
+	return &SQLite{ctx: context.Background()}
+}
+
+// GetName get dialect's name
+func (s *SQLite) GetName() string {
+	return "sqlite3"
+}
+
+// SetDB set db for dialect
+func (s *SQLite) SetDB(db model.SQLCommon) {
+	s.db = db
+}
+
+// SetContext sets the context used by the queries executed by the dialect.
+func (s *SQLite) SetContext(ctx context.Context) {
+	s.ctx = ctx
+}
+
+// BindVar return the placeholder for actual values in SQL statements, sqlite
+// uses ?
+func (s *SQLite) BindVar(i int) string {
+	return "?"
+}
+
+// Quote quotes field name to avoid SQL parsing exceptions by using a reserved word as a field name
+func (s *SQLite) Quote(key string) string {
+	return fmt.Sprintf(`"%s"`, key)
+}
+
+//PrimaryKey implements dialects.Dialect interface. It returns the PRIMARY KEY
+//clause for the keys.
+func (s *SQLite) PrimaryKey(keys []string) string {
+	return fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(keys, ","))
+}
+
+// DataTypeOf return data's sql type
+//
+// Integer primary keys are mapped to integer primary key autoincrement, this
+// is the only way sqlite supports AUTOINCREMENT so the primary key is part of
+// the column type.
+func (s *SQLite) DataTypeOf(field *model.StructField) (string, error) {
+	var dataValue, sqlType, size, additionalType = dialects.ParseFieldStructForDialect(field)
+	if sqlType == "" {
+		switch dataValue.Kind() {
+		case reflect.Bool:
+			sqlType = "bool"
+		case reflect.Int,
+			reflect.Int8,
+			reflect.Int16,
+			reflect.Int32,
+			reflect.Uint,
+			reflect.Uint8,
+			reflect.Uint16,
+			reflect.Uint32,
+			reflect.Uintptr:
+			if dialects.FieldCanAutoIncrement(field) {
+				field.TagSettings["AUTO_INCREMENT"] = "AUTO_INCREMENT"
+				sqlType = "integer primary key autoincrement"
+			} else {
+				sqlType = "integer"
+			}
+		case reflect.Int64, reflect.Uint64:
+			if dialects.FieldCanAutoIncrement(field) {
+				field.TagSettings["AUTO_INCREMENT"] = "AUTO_INCREMENT"
+				sqlType = "integer primary key autoincrement"
+			} else {
+				sqlType = "bigint"
+			}
+		case reflect.Float32, reflect.Float64:
+			sqlType = "real"
+		case reflect.String:
+			if size > 0 && size < 65532 {
+				sqlType = fmt.Sprintf("varchar(%d)", size)
+			} else {
+				sqlType = "text"
+			}
+		case reflect.Struct:
+			if _, ok := dataValue.Interface().(time.Time); ok {
+				sqlType = "datetime"
+			}
+		default:
+			if _, ok := dataValue.Interface().([]byte); ok {
+				sqlType = "blob"
+			}
+		}
+	}
+	if sqlType == "" {
+		return "", fmt.Errorf("invalid sql type %s (%s) for sqlite3", dataValue.Type().Name(), dataValue.Kind().String())
+	}
+
+	if strings.TrimSpace(additionalType) == "" {
+		return sqlType, nil
+	}
+	return fmt.Sprintf("%v %v", sqlType, additionalType), nil
+}
+
+// HasIndex check has index or not
+func (s *SQLite) HasIndex(tableName string, indexName string) bool {
+	query := "SELECT count(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name = ?"
+	var count int
+	err := s.db.QueryRowContext(s.ctx, query, tableName, indexName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// HasForeignKey check has foreign key or not. sqlite doesn't keep the names
+// of foreign keys so this always returns false.
+func (s *SQLite) HasForeignKey(tableName string, foreignKeyName string) bool {
+	return false
+}
+
+// RemoveIndex remove index
+func (s *SQLite) RemoveIndex(tableName string, indexName string) error {
+	_, err := s.db.ExecContext(s.ctx, fmt.Sprintf("DROP INDEX %v", s.Quote(indexName)))
+	return err
+}
+
+// HasTable check has table or not
+func (s *SQLite) HasTable(tableName string) bool {
+	query := "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	var count int
+	err := s.db.QueryRowContext(s.ctx, query, tableName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// HasColumn check has column or not
+func (s *SQLite) HasColumn(tableName string, columnName string) bool {
+	query := "SELECT count(*) FROM pragma_table_info(?) WHERE name = ?"
+	var count int
+	err := s.db.QueryRowContext(s.ctx, query, tableName, columnName).Scan(&count)
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// Columns returns the columns of the table from PRAGMA table_info.
+func (s *SQLite) Columns(tableName string) ([]model.Column, error) {
+	query := `SELECT name, type, "notnull", dflt_value FROM pragma_table_info(?) ORDER BY cid`
+	rows, err := s.db.QueryContext(s.ctx, query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var columns []model.Column
+	for rows.Next() {
+		var (
+			c       model.Column
+			notNull bool
+			def     sql.NullString
+		)
+		err = rows.Scan(&c.Name, &c.Type, &notNull, &def)
+		if err != nil {
+			return nil, err
+		}
+		c.Nullable = !notNull
+		c.Default, c.HasDefault = def.String, def.Valid
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// Indexes returns the indexes of the table that were created with CREATE
+// INDEX, the ones sqlite creates for PRIMARY KEY and UNIQUE are left out.
+func (s *SQLite) Indexes(tableName string) ([]model.Index, error) {
+	query := `SELECT il.name, ifnull(ii.name, ''), il."unique" FROM pragma_index_list(?) AS il, pragma_index_info(il.name) AS ii WHERE il.origin = 'c' ORDER BY il.name, ii.seqno`
+	rows, err := s.db.QueryContext(s.ctx, query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return dialects.ScanIndexes(rows)
+}
+
+// LimitAndOffsetSQL return generated SQL with Limit and Offset. sqlite only
+// accepts OFFSET after LIMIT, so LIMIT -1 is used when there is only an offset.
+func (s *SQLite) LimitAndOffsetSQL(limit, offset interface{}) (sql string) {
+	var hasLimit bool
+	if limit != nil {
+		if parsedLimit, err := strconv.ParseInt(fmt.Sprint(limit), 0, 0); err == nil && parsedLimit >= 0 {
+			sql += fmt.Sprintf(" LIMIT %d", parsedLimit)
+			hasLimit = true
+		}
+	}
+	if offset != nil {
+		if parsedOffset, err := strconv.ParseInt(fmt.Sprint(offset), 0, 0); err == nil && parsedOffset > 0 {
+			if !hasLimit {
+				sql += " LIMIT -1"
+			}
+			sql += fmt.Sprintf(" OFFSET %d", parsedOffset)
+		}
+	}
+	return
+}
+
+// SelectFromDummyTable return select values, for most dbs, `SELECT values` just works, mysql needs `SELECT value FROM DUAL`
+func (s *SQLite) SelectFromDummyTable() string {
+	return ""
+}
+
+// LastInsertIDReturningSuffix returns an empty string, sqlite supports
+// LastInsertId.
+func (s *SQLite) LastInsertIDReturningSuffix(tableName, columnName string) string {
+	return ""
+}
+
+// OnConflictSQL implements dialects.Upserter with ON CONFLICT ... DO UPDATE,
+// the inserted values are referenced with the excluded table.
+func (s *SQLite) OnConflictSQL(columns, updates []string) string {
+	if len(updates) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(columns, ","))
+	}
+	var sets []string
+	for _, column := range updates {
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", column, column))
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s",
+		strings.Join(columns, ","), strings.Join(sets, ","))
+}
+
+// MaxBindVars implements dialects.BatchInserter, it is the default
+// SQLITE_MAX_VARIABLE_NUMBER of sqlite versions before 3.32.0.
+func (s *SQLite) MaxBindVars() int {
+	return 999
+}
+
+// FirstInsertID implements dialects.BatchInserter. last_insert_rowid is the
+// rowid of the last row inserted by the statement, the rows of a statement get
+// consecutive rowids.
+func (s *SQLite) FirstInsertID(lastInsertID, n int64) (int64, bool) {
+	return lastInsertID - n + 1, true
+}
+
+// LastInsertIDOutputInterstitial returns an empty string, the OUTPUT clause is
+// only used by mssql.
+func (s *SQLite) LastInsertIDOutputInterstitial(tableName, columnName string, columns []string) string {
+	return ""
+}
+
+// BuildForeignKeyName returns a foreign key name for the given table, field and reference
+func (s *SQLite) BuildForeignKeyName(tableName, field, dest string) string {
+	keyName := fmt.Sprintf("%s_%s_%s_foreign", tableName, field, dest)
+	keyName = regexes.KeyName.ReplaceAllString(keyName, "_")
+	return keyName
+}
+
+// CreateIndexSQL implements dialects.IndexCreator. sqlite supports sort
+// orders, partial indexes and expressions but has a single index method.
+func (s *SQLite) CreateIndexSQL(tableName string, index *model.Index) (string, error) {
+	err := dialects.CheckIndex(s, index, dialects.IndexOptions{
+		Sort: true, Where: true, Expression: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	sql := fmt.Sprintf("%s %v ON %v(%v)", dialects.CreateIndex(index), index.Name,
+		tableName, dialects.IndexColumns(s, index))
+	if index.Where != "" {
+		sql += " WHERE " + index.Where
+	}
+	return sql, nil
+}
+
+// ForeignKeySQL implements dialects.ForeignKeyer. The constraints are only
+// enforced when the foreign_keys pragma is on.
+func (s *SQLite) ForeignKeySQL(fk *model.ForeignKey) (string, error) {
+	return dialects.ForeignKeySQL(s, fk, dialects.ReferentialActions...)
+}
+
+// InlineForeignKeys implements dialects.ForeignKeyer, sqlite can't add
+// constraints to existing tables.
+func (s *SQLite) InlineForeignKeys() bool {
+	return true
+}
+
+// CurrentDatabase return current database name. The columns returned by PRAGMA
+// database_list are seq, name and file, the name of the first database is
+// returned.
+func (s *SQLite) CurrentDatabase() string {
+	var seq int
+	var name, file string
+	err := s.db.QueryRowContext(s.ctx, "PRAGMA database_list").Scan(&seq, &name, &file)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+//QueryFieldName returns prefix for field names if name. For instance users.id
+//to point to users id field.
+func (s *SQLite) QueryFieldName(name string) string {
+	return name + "."
+}
+
+// SavePoint returns the sql for creating a savepoint.
+func (s *SQLite) SavePoint(name string) string {
+	return "SAVEPOINT " + s.Quote(name)
+}
+
+// RollbackToSavePoint returns the sql for rolling back to a savepoint.
+func (s *SQLite) RollbackToSavePoint(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + s.Quote(name)
+}
+
+// ReleaseSavePoint returns the sql for releasing a savepoint.
+func (s *SQLite) ReleaseSavePoint(name string) string {
+	return "RELEASE SAVEPOINT " + s.Quote(name)
+}
@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gernest/ngorm/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const migration = `
+CREATE TABLE orders (id integer primary key autoincrement, customer_id integer, date datetime);
+CREATE INDEX orders_date ON orders (date);
+`
+
+func TestDialect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ngorm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	_, err = db.Exec(migration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialect := New()
+	if dialect.GetName() != "sqlite3" {
+		t.Errorf("expected sqlite3 got %s", dialect.GetName())
+	}
+	dialect.SetDB(db)
+
+	if !dialect.HasTable("orders") {
+		t.Error("expected to be true")
+	}
+	if dialect.HasTable("items") {
+		t.Error("expected to be false")
+	}
+	if !dialect.HasColumn("orders", "customer_id") {
+		t.Error("expected to be true")
+	}
+	if dialect.HasColumn("orders", "quantity") {
+		t.Error("expected to be false")
+	}
+	if !dialect.HasIndex("orders", "orders_date") {
+		t.Error("expected to be true")
+	}
+	err = dialect.RemoveIndex("orders", "orders_date")
+	if err != nil {
+		t.Error(err)
+	}
+	if dialect.HasIndex("orders", "orders_date") {
+		t.Error("expected to be false")
+	}
+	if name := dialect.CurrentDatabase(); name != "main" {
+		t.Errorf("expected main got %s", name)
+	}
+}
+
+func TestSQLite_DataTypeOf(t *testing.T) {
+	s := New()
+	sample := []struct {
+		value  interface{}
+		tags   map[string]string
+		pk     bool
+		expect string
+	}{
+		{true, nil, false, "bool"},
+		{int(1), nil, false, "integer"},
+		{int(1), nil, true, "integer primary key autoincrement"},
+		{int64(1), nil, false, "bigint"},
+		{int64(1), nil, true, "integer primary key autoincrement"},
+		{int64(1), map[string]string{"AUTO_INCREMENT": "false"}, true, "bigint"},
+		{1.5, nil, false, "real"},
+		{"", nil, false, "varchar(255)"},
+		{"", map[string]string{"SIZE": "70000"}, false, "text"},
+		{"", map[string]string{"NOT NULL": "NOT NULL"}, false, "varchar(255) NOT NULL"},
+		{"", map[string]string{"TYPE": "clob"}, false, "clob"},
+		{time.Time{}, nil, false, "datetime"},
+		{[]byte{}, nil, false, "blob"},
+	}
+	for _, v := range sample {
+		tags := make(map[string]string)
+		for k, val := range v.tags {
+			tags[k] = val
+		}
+		field := &model.StructField{
+			Struct:       reflect.StructField{Type: reflect.TypeOf(v.value)},
+			IsPrimaryKey: v.pk,
+			TagSettings:  tags,
+		}
+		typ, err := s.DataTypeOf(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != v.expect {
+			t.Errorf("expected %s got %s", v.expect, typ)
+		}
+	}
+}
+
+func TestSQLite_LimitAndOffsetSQL(t *testing.T) {
+	s := New()
+	sample := []struct {
+		limit, offset interface{}
+		expect        string
+	}{
+		{10, nil, " LIMIT 10"},
+		{10, 5, " LIMIT 10 OFFSET 5"},
+		{nil, 5, " LIMIT -1 OFFSET 5"},
+		{nil, nil, ""},
+	}
+	for _, v := range sample {
+		sql := s.LimitAndOffsetSQL(v.limit, v.offset)
+		if sql != v.expect {
+			t.Errorf("expected %q got %q", v.expect, sql)
+		}
+	}
+}
+
+func TestSQLite_Quote(t *testing.T) {
+	s := New()
+	expect := `"quote"`
+	v := s.Quote("quote")
+	if v != expect {
+		t.Errorf("expected %s got %s", expect, v)
+	}
+	if s.BindVar(2) != "?" {
+		t.Errorf("expected ? got %s", s.BindVar(2))
+	}
+}
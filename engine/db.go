@@ -31,6 +31,22 @@ type Engine struct {
 	Now func() time.Time
 }
 
+//Clone returns a new Engine that shares the database, dialect and settings of
+//e, with an empty Scope and Search.
+func (e *Engine) Clone() *Engine {
+	return &Engine{
+		Scope:         model.NewScope(),
+		Search:        &model.Search{},
+		SingularTable: e.SingularTable,
+		Ctx:           e.Ctx,
+		Dialect:       e.Dialect,
+		StructMap:     e.StructMap,
+		SQLDB:         e.SQLDB,
+		Log:           e.Log,
+		Now:           e.Now,
+	}
+}
+
 //AddError adds err to Engine.Error.
 //
 // THis is here until I refactor all the APIs to return errors instead of
@@ -18,6 +18,10 @@ var (
 	// ErrCantStartTransaction can't start transaction when you are trying to start one with `Begin`
 	ErrCantStartTransaction = errors.New("can't start transaction")
 
+	// ErrSavePointUnsupported happens when starting a nested transaction with a
+	// dialect that doesn't support savepoints
+	ErrSavePointUnsupported = errors.New("savepoints are not supported")
+
 	// ErrUnaddressable unaddressable value
 	ErrUnaddressable = errors.New("using unaddressable value")
 
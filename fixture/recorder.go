@@ -0,0 +1,205 @@
+package fixture
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+//Recorder is a database/sql driver that doesn't talk to any database. It
+//records the queries executed on it and answers them with the rows registered
+//by Reply. This is used to test the SQL generated for databases whose servers
+//are not available when running the tests.
+type Recorder struct {
+	//LastInsertID is the value returned by sql.Result.LastInsertId
+	LastInsertID int64
+
+	mu      sync.Mutex
+	queries []Query
+	replies []reply
+}
+
+//Query is a query that was executed on the Recorder.
+type Query struct {
+	SQL  string
+	Args []interface{}
+}
+
+type reply struct {
+	match   string
+	columns []string
+	rows    [][]interface{}
+}
+
+//NewRecorder returns a new Recorder and a *sql.DB that uses it.
+func NewRecorder() (*Recorder, *sql.DB) {
+	r := &Recorder{}
+	return r, sql.OpenDB(recorderConnector{r: r})
+}
+
+//Reply registers the rows that are returned by queries containing match. The
+//replies are matched in the order they were registered. Queries that don't
+//match any reply return no rows. The values in rows must be valid
+//driver.Value, for instance int64 instead of int.
+func (r *Recorder) Reply(match string, columns []string, rows ...[]interface{}) {
+	r.mu.Lock()
+	r.replies = append(r.replies, reply{match: match, columns: columns, rows: rows})
+	r.mu.Unlock()
+}
+
+//Queries returns the queries that were executed so far. Transactions are
+//recorded as BEGIN, COMMIT and ROLLBACK queries.
+func (r *Recorder) Queries() []Query {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Query{}, r.queries...)
+}
+
+//Last returns the last query that was executed.
+func (r *Recorder) Last() Query {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.queries) == 0 {
+		return Query{}
+	}
+	return r.queries[len(r.queries)-1]
+}
+
+//Reset clears the recorded queries.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.queries = nil
+	r.mu.Unlock()
+}
+
+func (r *Recorder) record(query string, args []driver.Value) *reply {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q := Query{SQL: query}
+	for _, a := range args {
+		q.Args = append(q.Args, a)
+	}
+	r.queries = append(r.queries, q)
+	for i := range r.replies {
+		if strings.Contains(query, r.replies[i].match) {
+			return &r.replies[i]
+		}
+	}
+	return nil
+}
+
+type recorderConnector struct {
+	r *Recorder
+}
+
+func (c recorderConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recorderConn{r: c.r}, nil
+}
+
+func (c recorderConnector) Driver() driver.Driver {
+	return recorderDriver{}
+}
+
+type recorderDriver struct{}
+
+func (recorderDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fixture: use NewRecorder to open a recorder")
+}
+
+type recorderConn struct {
+	r *Recorder
+}
+
+func (c *recorderConn) Prepare(query string) (driver.Stmt, error) {
+	return &recorderStmt{r: c.r, query: query}, nil
+}
+
+func (c *recorderConn) Close() error {
+	return nil
+}
+
+func (c *recorderConn) Begin() (driver.Tx, error) {
+	c.r.record("BEGIN", nil)
+	return recorderTx{r: c.r}, nil
+}
+
+type recorderTx struct {
+	r *Recorder
+}
+
+func (tx recorderTx) Commit() error {
+	tx.r.record("COMMIT", nil)
+	return nil
+}
+
+func (tx recorderTx) Rollback() error {
+	tx.r.record("ROLLBACK", nil)
+	return nil
+}
+
+type recorderStmt struct {
+	r     *Recorder
+	query string
+}
+
+func (s *recorderStmt) Close() error {
+	return nil
+}
+
+func (s *recorderStmt) NumInput() int {
+	return -1
+}
+
+func (s *recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.r.record(s.query, args)
+	return recorderResult{id: s.r.LastInsertID}, nil
+}
+
+func (s *recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rp := s.r.record(s.query, args)
+	if rp == nil {
+		return &recorderRows{}, nil
+	}
+	return &recorderRows{columns: rp.columns, rows: rp.rows}, nil
+}
+
+type recorderResult struct {
+	id int64
+}
+
+func (r recorderResult) LastInsertId() (int64, error) {
+	return r.id, nil
+}
+
+func (r recorderResult) RowsAffected() (int64, error) {
+	return 1, nil
+}
+
+type recorderRows struct {
+	columns []string
+	rows    [][]interface{}
+	pos     int
+}
+
+func (r *recorderRows) Columns() []string {
+	return r.columns
+}
+
+func (r *recorderRows) Close() error {
+	return nil
+}
+
+func (r *recorderRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	for i, v := range r.rows[r.pos] {
+		dest[i] = v
+	}
+	r.pos++
+	return nil
+}
@@ -3,6 +3,9 @@ package hooks
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"reflect"
@@ -11,6 +14,8 @@ import (
 	"time"
 
 	"github.com/gernest/ngorm/builder"
+	"github.com/gernest/ngorm/clause"
+	"github.com/gernest/ngorm/dialects"
 	"github.com/gernest/ngorm/engine"
 	"github.com/gernest/ngorm/errmsg"
 	"github.com/gernest/ngorm/model"
@@ -20,6 +25,9 @@ import (
 )
 
 //Query executes sql QUery without transaction.
+//
+// If there are associations to preload, the hook registered with key
+// model.HookQueryPreload is executed after the query.
 func Query(b *Book, e *engine.Engine) error {
 	sql, ok := b.Query.Get(model.HookQuerySQL)
 	if !ok {
@@ -33,7 +41,16 @@ func Query(b *Book, e *engine.Engine) error {
 	if !ok {
 		return errors.New("missing query exec hook")
 	}
-	return exec.Exec(b, e)
+	err = exec.Exec(b, e)
+	if err != nil {
+		return err
+	}
+	if len(e.Search.Preload) > 0 {
+		if p, ok := b.Query.Get(model.HookQueryPreload); ok {
+			return p.Exec(b, e)
+		}
+	}
+	return nil
 }
 
 //QueryExec  executes SQL querries.
@@ -64,7 +81,7 @@ func QueryExec(b *Book, e *engine.Engine) error {
 		e.Scope.SQL += util.AddExtraSpaceIfExist(fmt.Sprint(str))
 	}
 
-	rows, err := e.SQLDB.Query(e.Scope.SQL, e.Scope.SQLVars...)
+	rows, err := e.SQLDB.QueryContext(e.Ctx, e.Scope.SQL, e.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
@@ -83,7 +100,10 @@ func QueryExec(b *Book, e *engine.Engine) error {
 		if err != nil {
 			return err
 		}
-		scope.Scan(rows, columns, fields)
+		err = scope.Scan(rows, columns, fields)
+		if err != nil {
+			return err
+		}
 		if isSlice {
 			if isPtr {
 				results.Set(reflect.Append(results, elem.Addr()))
@@ -92,6 +112,9 @@ func QueryExec(b *Book, e *engine.Engine) error {
 			}
 		}
 	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
 	if e.RowsAffected == 0 && !isSlice {
 		return errmsg.ErrRecordNotFound
 	}
@@ -144,40 +167,13 @@ func BeforeCreate(b *Book, e *engine.Engine) error {
 
 //Create the hook executed to create a new record.
 func Create(b *Book, e *engine.Engine) error {
-	var (
-		columns, placeholders []string
-
-		// The blank columns with default values
-		cv []string
-	)
-	fds, err := scope.Fields(e, e.Scope.Value)
+	columns, values, err := insertValues(e)
 	if err != nil {
 		return err
 	}
-
-	for _, field := range fds {
-		if scope.ChangeableField(e, field) {
-			if field.IsNormal {
-				if field.IsBlank && field.HasDefaultValue {
-					cv = append(cv, scope.Quote(e, field.DBName))
-					e.Scope.Set(model.BlankColWithValue, cv)
-				} else if !field.IsPrimaryKey || !field.IsBlank {
-					columns = append(columns, scope.Quote(e, field.DBName))
-					placeholders = append(placeholders, scope.AddToVars(e, field.Field.Interface()))
-				}
-			} else if field.Relationship != nil && field.Relationship.Kind == "belongs_to" {
-				for _, foreignKey := range field.Relationship.ForeignDBNames {
-					foreignField, err := scope.FieldByName(e, e.Scope.Value, foreignKey)
-					if err != nil {
-						return err
-					}
-					if !scope.ChangeableField(e, foreignField) {
-						columns = append(columns, scope.Quote(e, foreignField.DBName))
-						placeholders = append(placeholders, scope.AddToVars(e, foreignField.Field.Interface()))
-					}
-				}
-			}
-		}
+	var placeholders []string
+	for _, value := range values {
+		placeholders = append(placeholders, scope.AddToVars(e, value))
 	}
 
 	var (
@@ -194,6 +190,17 @@ func Create(b *Book, e *engine.Engine) error {
 	if str, ok := e.Scope.Get(model.InsertOptions); ok {
 		extraOption = fmt.Sprint(str)
 	}
+	if oc, columns, ok := upsertOption(e); ok {
+		u := e.Dialect.(dialects.Upserter)
+		var quoted, updates []string
+		for _, column := range columns {
+			quoted = append(quoted, scope.Quote(e, column))
+		}
+		for _, column := range oc.DoUpdates {
+			updates = append(updates, scope.Quote(e, column))
+		}
+		extraOption = strings.TrimSpace(u.OnConflictSQL(quoted, updates) + " " + extraOption)
+	}
 
 	if primaryField != nil {
 		returningColumn = scope.Quote(e, primaryField.DBName)
@@ -201,20 +208,24 @@ func Create(b *Book, e *engine.Engine) error {
 
 	lastInsertIDReturningSuffix :=
 		e.Dialect.LastInsertIDReturningSuffix(tableName, returningColumn)
+	lastInsertIDOutputInterstitial :=
+		e.Dialect.LastInsertIDOutputInterstitial(tableName, returningColumn, columns)
 
 	if len(columns) == 0 {
 		sql := fmt.Sprintf(
-			"INSERT INTO %v DEFAULT VALUES%v%v",
+			"INSERT INTO %v%v DEFAULT VALUES%v%v",
 			tableName,
+			util.AddExtraSpaceIfExist(lastInsertIDOutputInterstitial),
 			util.AddExtraSpaceIfExist(extraOption),
 			util.AddExtraSpaceIfExist(lastInsertIDReturningSuffix),
 		)
 		e.Scope.SQL = strings.Replace(sql, "$$", "?", -1)
 	} else {
 		sql := fmt.Sprintf(
-			"INSERT INTO %v (%v) VALUES (%v)%v%v",
+			"INSERT INTO %v (%v)%v VALUES (%v)%v%v",
 			scope.QuotedTableName(e, e.Scope.Value),
 			strings.Join(columns, ","),
+			util.AddExtraSpaceIfExist(lastInsertIDOutputInterstitial),
 			strings.Join(placeholders, ","),
 			util.AddExtraSpaceIfExist(extraOption),
 			util.AddExtraSpaceIfExist(lastInsertIDReturningSuffix),
@@ -225,8 +236,51 @@ func Create(b *Book, e *engine.Engine) error {
 	return nil
 }
 
+//insertValues returns the quoted columns and the values of e.Scope.Value that
+//are inserted by the INSERT query. Blank fields with default values are left
+//out and their quoted columns are set on the scope with the key
+//model.BlankColWithValue.
+func insertValues(e *engine.Engine) (columns []string, values []interface{}, err error) {
+	// The blank columns with default values
+	var cv []string
+	fds, err := scope.Fields(e, e.Scope.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, field := range fds {
+		if scope.ChangeableField(e, field) {
+			if field.IsNormal {
+				if field.IsBlank && field.HasDefaultValue {
+					cv = append(cv, scope.Quote(e, field.DBName))
+					e.Scope.Set(model.BlankColWithValue, cv)
+				} else if !field.IsPrimaryKey || !field.IsBlank {
+					columns = append(columns, scope.Quote(e, field.DBName))
+					values = append(values, field.Field.Interface())
+				}
+			} else if field.Relationship != nil && field.Relationship.Kind == "belongs_to" {
+				for _, foreignKey := range field.Relationship.ForeignDBNames {
+					foreignField, err := scope.FieldByName(e, e.Scope.Value, foreignKey)
+					if err != nil {
+						return nil, nil, err
+					}
+					if !scope.ChangeableField(e, foreignField) {
+						columns = append(columns, scope.Quote(e, foreignField.DBName))
+						values = append(values, foreignField.Field.Interface())
+					}
+				}
+			}
+		}
+	}
+	return columns, values, nil
+}
+
 //CreateExec executes the INSERT query and assigns primary key if it is not set
 //assuming the primary key is the ID field.
+//
+// For dialects that return the primary key from the INSERT query itself, like
+// postgres with RETURNING or mssql with OUTPUT INSERTED, the query is executed
+// with QueryRow and the returned value is scanned into the primary key.
 func CreateExec(b *Book, e *engine.Engine) error {
 	primaryField, err := scope.PrimaryField(e, e.Scope.Value)
 	if err != nil {
@@ -239,28 +293,21 @@ func CreateExec(b *Book, e *engine.Engine) error {
 	tableName := scope.QuotedTableName(e, e.Scope.Value)
 	lastInsertIDReturningSuffix :=
 		e.Dialect.LastInsertIDReturningSuffix(tableName, returningColumn)
-	if lastInsertIDReturningSuffix == "" || primaryField == nil {
-		tx, err := e.SQLDB.Begin()
-		if err != nil {
-			return err
-		}
-		result, err := tx.Exec(e.Scope.SQL, e.Scope.SQLVars...)
-		if err != nil {
-			rerr := tx.Rollback()
-			if rerr != nil {
-				return rerr
-			}
-			return err
-		}
-		err = tx.Commit()
+	lastInsertIDOutputInterstitial :=
+		e.Dialect.LastInsertIDOutputInterstitial(tableName, returningColumn, nil)
+	_, conflictColumns, upsert := upsertOption(e)
+	if (lastInsertIDReturningSuffix == "" && lastInsertIDOutputInterstitial == "") ||
+		primaryField == nil {
+		result, err := ExecTx(e, e.Scope.SQL, e.Scope.SQLVars...)
 		if err != nil {
 			return err
 		}
 		// set rows affected count
 		e.RowsAffected, _ = result.RowsAffected()
 
-		// set primary value to primary field
-		if primaryField != nil && primaryField.IsBlank {
+		// set primary value to primary field, the id of an updated row isn't
+		// reported by all the databases so upserts look it up instead.
+		if primaryField != nil && primaryField.IsBlank && !upsert {
 			primaryValue, err := result.LastInsertId()
 			if err != nil {
 				return err
@@ -269,19 +316,323 @@ func CreateExec(b *Book, e *engine.Engine) error {
 		}
 	} else {
 		if primaryField.Field.CanAddr() {
-			err := e.SQLDB.QueryRow(
+			err := e.SQLDB.QueryRowContext(
+				e.Ctx,
 				e.Scope.SQL,
 				e.Scope.SQLVars...,
 			).Scan(primaryField.Field.Addr().Interface())
-			if err != nil {
+			switch {
+			case err == sql.ErrNoRows && upsert:
+				// DO NOTHING returns no row when the existing row is kept.
+			case err != nil:
 				return err
+			default:
+				primaryField.IsBlank = false
+				e.RowsAffected = 1
 			}
-			primaryField.IsBlank = false
-			e.RowsAffected = 1
 		} else {
 			return errmsg.ErrUnaddressable
 		}
 	}
+	if upsert && primaryField != nil && primaryField.IsBlank {
+		return upsertPrimaryKey(e, primaryField, conflictColumns)
+	}
+	return nil
+}
+
+//DefaultBatchSize is the maximum number of records inserted by a single
+//statement of CreateBatch, unless it is set on the scope with the key
+//model.BatchSize.
+const DefaultBatchSize = 100
+
+//CreateBatch creates the records of the slice e.Scope.Value.
+//
+// The records are inserted in chunks of DefaultBatchSize with multi-row
+// INSERT ... VALUES statements when the dialect implements
+// dialects.BatchInserter, one row at a time otherwise. The chunks are made
+// smaller when they would exceed the bind variables limit of the dialect.
+// Consecutive records that don't insert the same columns, because of blank
+// fields with default values or blank primary keys, go in separate statements.
+//
+// The hooks of each record are executed like for a single record, the before
+// create hooks before the statement of its chunk and the after create hooks
+// after it. The primary keys are set when the database reports them.
+func CreateBatch(b *Book, e *engine.Engine) error {
+	records := reflect.Indirect(reflect.ValueOf(e.Scope.Value))
+	if records.Kind() != reflect.Slice {
+		return errors.New("unsupported value, should be a slice")
+	}
+	engines := make([]*engine.Engine, records.Len())
+	for i := range engines {
+		record := records.Index(i)
+		if record.Kind() != reflect.Ptr {
+			record = record.Addr()
+		} else if record.IsNil() {
+			return fmt.Errorf("nil record at index %d", i)
+		}
+		ne := cloneEngine(e)
+		for k, v := range e.Scope.GetAll() {
+			ne.Scope.Set(k, v)
+		}
+		ne.Scope.Value = record.Interface()
+		engines[i] = ne
+	}
+	bi, ok := e.Dialect.(dialects.BatchInserter)
+	if !ok {
+		for _, ne := range engines {
+			err := createRecord(b, ne)
+			if err != nil {
+				return err
+			}
+			e.RowsAffected += ne.RowsAffected
+		}
+		return nil
+	}
+	size := DefaultBatchSize
+	if v, ok := e.Scope.Get(model.BatchSize); ok {
+		if n, ok := v.(int); ok && n > 0 {
+			size = n
+		}
+	}
+	for start := 0; start < len(engines); start += size {
+		end := start + size
+		if end > len(engines) {
+			end = len(engines)
+		}
+		var (
+			chunk   = engines[start:end]
+			columns = make([][]string, len(chunk))
+			values  = make([][]interface{}, len(chunk))
+		)
+		for i, ne := range chunk {
+			err := beforeCreate(b, ne)
+			if err != nil {
+				return err
+			}
+			columns[i], values[i], err = insertValues(ne)
+			if err != nil {
+				return err
+			}
+		}
+		for i := 0; i < len(chunk); {
+			j := i + 1
+			if len(columns[i]) > 0 {
+				key := strings.Join(columns[i], ",")
+				for j < len(chunk) && strings.Join(columns[j], ",") == key &&
+					(j-i+1)*len(columns[i]) <= bi.MaxBindVars() {
+					j++
+				}
+			}
+			err := insertBatch(b, e, bi, chunk[i:j], columns[i], values[i:j])
+			if err != nil {
+				return err
+			}
+			i = j
+		}
+	}
+	return nil
+}
+
+//insertBatch inserts the records of engines with a single statement. columns
+//are the quoted columns inserted for all the records and values the values of
+//the columns of each record.
+func insertBatch(b *Book, e *engine.Engine, bi dialects.BatchInserter, engines []*engine.Engine, columns []string, values [][]interface{}) error {
+	if len(engines) == 1 {
+		ne := engines[0]
+		c, ok := b.Create.Get(model.Create)
+		if !ok {
+			return errors.New("missing create hook")
+		}
+		err := c.Exec(b, ne)
+		if err != nil {
+			return err
+		}
+		ce, ok := b.Create.Get(model.HookCreateExec)
+		if !ok {
+			return errors.New("missing create exec hook")
+		}
+		err = ce.Exec(b, ne)
+		if err != nil {
+			return err
+		}
+		e.RowsAffected += ne.RowsAffected
+		return afterCreate(b, ne)
+	}
+	ne := cloneEngine(e)
+	value := engines[0].Scope.Value
+	var rows []string
+	for _, v := range values {
+		var placeholders []string
+		for _, value := range v {
+			placeholders = append(placeholders, scope.AddToVars(ne, value))
+		}
+		rows = append(rows, "("+strings.Join(placeholders, ",")+")")
+	}
+	var (
+		returningColumn = "*"
+		tableName       = scope.QuotedTableName(ne, value)
+
+		extraOption string
+	)
+	primaryField, err := scope.PrimaryField(ne, value)
+	if err != nil {
+		return err
+	}
+	if str, ok := e.Scope.Get(model.InsertOptions); ok {
+		extraOption = fmt.Sprint(str)
+	}
+	if primaryField != nil {
+		returningColumn = scope.Quote(ne, primaryField.DBName)
+	}
+	lastInsertIDReturningSuffix :=
+		ne.Dialect.LastInsertIDReturningSuffix(tableName, returningColumn)
+	lastInsertIDOutputInterstitial :=
+		ne.Dialect.LastInsertIDOutputInterstitial(tableName, returningColumn, columns)
+	sql := fmt.Sprintf(
+		"INSERT INTO %v (%v)%v VALUES %v%v%v",
+		tableName,
+		strings.Join(columns, ","),
+		util.AddExtraSpaceIfExist(lastInsertIDOutputInterstitial),
+		strings.Join(rows, ","),
+		util.AddExtraSpaceIfExist(extraOption),
+		util.AddExtraSpaceIfExist(lastInsertIDReturningSuffix),
+	)
+	sql = strings.Replace(sql, "$$", "?", -1)
+
+	var keys []*model.Field
+	if primaryField != nil && primaryField.IsBlank {
+		for _, re := range engines {
+			field, err := scope.PrimaryField(re, re.Scope.Value)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, field)
+		}
+	}
+	if keys != nil && (lastInsertIDReturningSuffix != "" || lastInsertIDOutputInterstitial != "") {
+		err = scanKeys(ne, sql, keys)
+		if err != nil {
+			return err
+		}
+		e.RowsAffected += int64(len(keys))
+	} else {
+		result, err := ExecTx(ne, sql, ne.Scope.SQLVars...)
+		if err != nil {
+			return err
+		}
+		n, _ := result.RowsAffected()
+		e.RowsAffected += n
+		if keys != nil {
+			last, err := result.LastInsertId()
+			if err != nil {
+				return err
+			}
+			if first, ok := bi.FirstInsertID(last, int64(len(keys))); ok {
+				for i, field := range keys {
+					_ = field.Set(first + int64(i))
+				}
+			}
+		}
+	}
+	for _, re := range engines {
+		err = afterCreate(b, re)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//scanKeys executes the INSERT query, which returns the primary keys of the
+//inserted rows, and scans them into keys.
+func scanKeys(e *engine.Engine, query string, keys []*model.Field) error {
+	rows, err := e.SQLDB.QueryContext(e.Ctx, query, e.Scope.SQLVars...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for _, field := range keys {
+		if !rows.Next() {
+			break
+		}
+		err = rows.Scan(field.Field.Addr().Interface())
+		if err != nil {
+			return err
+		}
+		field.IsBlank = false
+	}
+	return rows.Err()
+}
+
+//upsertOption returns the clause.OnConflict option set on the scope with the
+//key model.OnConflict and the names of its conflict columns, which default to
+//the primary keys. ok is false if the option isn't set or the dialect doesn't
+//implement dialects.Upserter.
+//
+// ok is false too when a conflict column is a blank primary key, which is
+// generated by the database so the record is inserted like without the option.
+func upsertOption(e *engine.Engine) (oc clause.OnConflict, columns []string, ok bool) {
+	v, ok := e.Scope.Get(model.OnConflict)
+	if !ok {
+		return
+	}
+	if oc, ok = v.(clause.OnConflict); !ok {
+		return
+	}
+	if _, ok = e.Dialect.(dialects.Upserter); !ok {
+		return
+	}
+	columns = oc.Columns
+	if len(columns) == 0 {
+		fields, err := scope.PrimaryFields(e, e.Scope.Value)
+		if err != nil {
+			return oc, nil, false
+		}
+		for _, field := range fields {
+			columns = append(columns, field.DBName)
+		}
+	}
+	for _, column := range columns {
+		field, err := scope.FieldByName(e, e.Scope.Value, column)
+		if err != nil {
+			return oc, nil, false
+		}
+		if field.IsBlank && field.IsPrimaryKey {
+			return oc, nil, false
+		}
+	}
+	return
+}
+
+//upsertPrimaryKey sets the primary key of the row that was inserted or updated
+//by an upsert by selecting it with the values of the conflict columns.
+func upsertPrimaryKey(e *engine.Engine, primaryField *model.Field, columns []string) error {
+	ne := cloneEngine(e)
+	var conditions []string
+	for _, column := range columns {
+		field, err := scope.FieldByName(ne, e.Scope.Value, column)
+		if err != nil {
+			return err
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = %s",
+			scope.Quote(ne, field.DBName), scope.AddToVars(ne, field.Field.Interface())))
+	}
+	if !primaryField.Field.CanAddr() {
+		return errmsg.ErrUnaddressable
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s",
+		scope.Quote(ne, primaryField.DBName),
+		scope.QuotedTableName(ne, e.Scope.Value),
+		strings.Join(conditions, " AND "),
+	)
+	err := ne.SQLDB.QueryRowContext(ne.Ctx, query, ne.Scope.SQLVars...).
+		Scan(primaryField.Field.Addr().Interface())
+	if err != nil {
+		return err
+	}
+	primaryField.IsBlank = false
 	return nil
 }
 
@@ -476,29 +827,161 @@ func SaveBeforeAssociation(b *Book, e *engine.Engine) error {
 	return nil
 }
 
-//CreateSQL generates SQL for creating new record
-func CreateSQL(b *Book, e *engine.Engine) error {
-	if bc, ok := b.Create.Get(model.BeforeCreate); ok {
-		err := bc.Exec(b, e)
-		if err != nil {
-			return err
-		}
+//SaveAfterAssociation saves the has_one, has_many and many_to_many
+//associations of the model. This is executed after the model is saved so the
+//foreign keys of the associated records are set from the primary key of the
+//model.
+//
+// Associated records with a blank primary key are created, the rest are
+// updated. For many_to_many associations a row linking the model to the
+// record is inserted into the join table if it doesn't exist yet.
+func SaveAfterAssociation(b *Book, e *engine.Engine) error {
+	if !scope.ShouldSaveAssociation(e) {
+		return nil
 	}
-
-	if scope.ShouldSaveAssociation(e) {
-		if ba, ok := b.Create.Get(model.HookSaveBeforeAss); ok {
-			err := ba.Exec(b, e)
+	fds, err := scope.Fields(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	for _, field := range fds {
+		ok, relationship := scope.SaveFieldAsAssociation(e, field)
+		if !ok {
+			continue
+		}
+		switch relationship.Kind {
+		case "has_one", "has_many", "many_to_many":
+		default:
+			continue
+		}
+		value := reflect.Indirect(field.Field)
+		var records []reflect.Value
+		if value.Kind() == reflect.Slice {
+			for i := 0; i < value.Len(); i++ {
+				records = append(records, value.Index(i))
+			}
+		} else {
+			records = append(records, value)
+		}
+		for _, record := range records {
+			if record.Kind() == reflect.Ptr {
+				if record.IsNil() {
+					continue
+				}
+			} else {
+				record = record.Addr()
+			}
+			if relationship.Kind == "many_to_many" {
+				err = saveAssociation(b, e, record.Interface())
+				if err != nil {
+					return err
+				}
+				expr, err := scope.JoinRelationSQL(e, relationship.JoinTableHandler, e.Scope.Value, record.Interface())
+				if err != nil {
+					return err
+				}
+				if expr != nil {
+					_, err = ExecTx(e, dialects.WrapTX(e.Dialect, expr.Q), expr.Args...)
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			// set the foreign keys of the associated record
+			for idx, fieldName := range relationship.ForeignFieldNames {
+				associationForeignName := relationship.AssociationForeignDBNames[idx]
+				foreignField, err := scope.FieldByName(e, e.Scope.Value, associationForeignName)
+				if err != nil {
+					return err
+				}
+				recordField, err := scope.FieldByName(e, record.Interface(), fieldName)
+				if err != nil {
+					return err
+				}
+				err = recordField.Set(foreignField.Field.Interface())
+				if err != nil {
+					return err
+				}
+			}
+			if relationship.PolymorphicType != "" {
+				typeField, err := scope.FieldByName(e, record.Interface(), relationship.PolymorphicType)
+				if err != nil {
+					return err
+				}
+				err = typeField.Set(relationship.PolymorphicValue)
+				if err != nil {
+					return err
+				}
+			}
+			err = saveAssociation(b, e, record.Interface())
 			if err != nil {
 				return err
 			}
 		}
 	}
-	if ts, ok := b.Create.Get(model.HookUpdateTimestamp); ok {
-		err := ts.Exec(b, e)
+	return nil
+}
+
+// saveAssociation creates value if its primary key is blank otherwise value is
+// updated.
+func saveAssociation(b *Book, e *engine.Engine, value interface{}) error {
+	ne := cloneEngine(e)
+	ne.Scope.Value = value
+	field, _ := scope.PrimaryField(ne, value)
+	if field != nil && !field.IsBlank {
+		u, ok := b.Update.Get(model.Update)
+		if !ok {
+			return errors.New("missing update hook")
+		}
+		return u.Exec(b, ne)
+	}
+	return createRecord(b, ne)
+}
+
+//createRecord builds and executes the INSERT query of e.Scope.Value and then
+//executes the hooks registered with the keys model.AfterCreate and
+//model.HookSaveAfterAss.
+func createRecord(b *Book, e *engine.Engine) error {
+	c, ok := b.Create.Get(model.HookCreateSQL)
+	if !ok {
+		return errors.New("missing create sql hook")
+	}
+	err := c.Exec(b, e)
+	if err != nil {
+		return err
+	}
+	ce, ok := b.Create.Get(model.HookCreateExec)
+	if !ok {
+		return errors.New("missing create exec hook")
+	}
+	err = ce.Exec(b, e)
+	if err != nil {
+		return err
+	}
+	return afterCreate(b, e)
+}
+
+//afterCreate executes the hooks registered with the keys model.AfterCreate and
+//model.HookSaveAfterAss after e.Scope.Value was inserted.
+func afterCreate(b *Book, e *engine.Engine) error {
+	if ac, ok := b.Create.Get(model.AfterCreate); ok {
+		err := ac.Exec(b, e)
 		if err != nil {
 			return err
 		}
 	}
+	if sa, ok := b.Create.Get(model.HookSaveAfterAss); ok {
+		return sa.Exec(b, e)
+	}
+	return nil
+}
+
+//CreateSQL generates SQL for creating new record
+func CreateSQL(b *Book, e *engine.Engine) error {
+	err := beforeCreate(b, e)
+	if err != nil {
+		return err
+	}
 	if c, ok := b.Create.Get(model.Create); ok {
 		err := c.Exec(b, e)
 		if err != nil {
@@ -506,6 +989,16 @@ func CreateSQL(b *Book, e *engine.Engine) error {
 		}
 	}
 	var buf bytes.Buffer
+	if !dialects.NeedsTX(e.Dialect) {
+		if e.Scope.MultiExpr {
+			for _, expr := range e.Scope.Exprs {
+				_, _ = buf.WriteString(expr.Q + ";\n")
+			}
+			_, _ = buf.WriteString(e.Scope.SQL)
+			e.Scope.SQL = buf.String()
+		}
+		return nil
+	}
 	_, _ = buf.WriteString("BEGIN TRANSACTION;\n")
 	if e.Scope.MultiExpr {
 		for _, expr := range e.Scope.Exprs {
@@ -518,17 +1011,103 @@ func CreateSQL(b *Book, e *engine.Engine) error {
 	return nil
 }
 
-func cloneEngine(e *engine.Engine) *engine.Engine {
-	return &engine.Engine{
-		Scope:         model.NewScope(),
-		Search:        &model.Search{},
-		SingularTable: e.SingularTable,
-		Ctx:           e.Ctx,
-		Dialect:       e.Dialect,
-		StructMap:     e.StructMap,
-		SQLDB:         e.SQLDB,
-		Log:           e.Log,
+//beforeCreate executes the hooks that are registered with the keys
+//model.BeforeCreate, model.HookSaveBeforeAss and model.HookUpdateTimestamp
+//before building the INSERT query of e.Scope.Value.
+func beforeCreate(b *Book, e *engine.Engine) error {
+	if bc, ok := b.Create.Get(model.BeforeCreate); ok {
+		err := bc.Exec(b, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	if scope.ShouldSaveAssociation(e) {
+		if ba, ok := b.Create.Get(model.HookSaveBeforeAss); ok {
+			err := ba.Exec(b, e)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if ts, ok := b.Create.Get(model.HookUpdateTimestamp); ok {
+		err := ts.Exec(b, e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//ExecTx executes query inside a transaction. If e.SQLDB is already bound to a
+//transaction the query is executed in it, committing is then left to the owner
+//of the transaction so any BEGIN TRANSACTION; ... COMMIT; block surrounding the
+//query is removed. Otherwise a new transaction is started and committed.
+func ExecTx(e *engine.Engine, query string, args ...interface{}) (sql.Result, error) {
+	if tx, ok := e.SQLDB.(*model.SQLTx); ok {
+		return tx.ExecContext(e.Ctx, util.UnwrapTX(query), args...)
+	}
+	tx, err := e.SQLDB.BeginTx(e.Ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.ExecContext(e.Ctx, query, args...)
+	if err != nil {
+		rerr := tx.Rollback()
+		if rerr != nil {
+			return nil, rerr
+		}
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
 	}
+	return result, nil
+}
+
+//ExecStepsTx executes the queries one by one in a single transaction, for
+//drivers that don't accept more than one statement per query. The result of
+//the last query is returned.
+//
+// When e is bound to a transaction the queries are executed in that
+// transaction instead.
+func ExecStepsTx(e *engine.Engine, queries ...string) (sql.Result, error) {
+	exec := func(execContext func(context.Context, string, ...interface{}) (sql.Result, error)) (sql.Result, error) {
+		var result sql.Result = driver.RowsAffected(0)
+		for _, query := range queries {
+			r, err := execContext(e.Ctx, query)
+			if err != nil {
+				return nil, err
+			}
+			result = r
+		}
+		return result, nil
+	}
+	if tx, ok := e.SQLDB.(*model.SQLTx); ok {
+		return exec(tx.ExecContext)
+	}
+	tx, err := e.SQLDB.BeginTx(e.Ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := exec(tx.ExecContext)
+	if err != nil {
+		rerr := tx.Rollback()
+		if rerr != nil {
+			return nil, rerr
+		}
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func cloneEngine(e *engine.Engine) *engine.Engine {
+	return e.Clone()
 }
 
 //UpdateSQL builds query for updating records.
@@ -596,6 +1175,9 @@ func UpdateSQL(b *Book, e *engine.Engine) error {
 		)
 
 	}
+	if !dialects.NeedsTX(e.Dialect) {
+		return nil
+	}
 	var buf bytes.Buffer
 	_, _ = buf.WriteString("BEGIN TRANSACTION;\n")
 	_, _ = buf.WriteString("\t" + e.Scope.SQL + ";\n")
@@ -610,24 +1192,16 @@ func UpdateExec(b *Book, e *engine.Engine) error {
 	if e.Scope.SQL == "" {
 		return errors.New("missing update sql ")
 	}
-	tx, err := e.SQLDB.Begin()
+	result, err := ExecTx(e, e.Scope.SQL, e.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
-	result, err := tx.Exec(e.Scope.SQL, e.Scope.SQLVars...)
-	if err != nil {
-		rerr := tx.Rollback()
-		if rerr != nil {
-			return rerr
-		}
-		return err
-	}
 	r, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 	e.RowsAffected = r
-	return tx.Commit()
+	return nil
 }
 
 //Update generates and executes sql query for updating records.This reliesn on
@@ -637,6 +1211,9 @@ func UpdateExec(b *Book, e *engine.Engine) error {
 //
 //	model.HookUpdateExec
 //which executes the UPDATE sql.
+//
+// The associations are then saved with the hook registered with key
+// model.HookSaveAfterAss if any.
 func Update(b *Book, e *engine.Engine) error {
 	sql, ok := b.Update.Get(model.HookUpdateSQL)
 	if !ok {
@@ -650,7 +1227,16 @@ func Update(b *Book, e *engine.Engine) error {
 	if !ok {
 		return errors.New("missing update exec hook")
 	}
-	return exec.Exec(b, e)
+	err = exec.Exec(b, e)
+	if err != nil {
+		return err
+	}
+	if scope.ShouldSaveAssociation(e) {
+		if sa, ok := b.Update.Get(model.HookSaveAfterAss); ok {
+			return sa.Exec(b, e)
+		}
+	}
+	return nil
 }
 
 func DeleteSQL(b *Book, e *engine.Engine) error {
@@ -664,7 +1250,7 @@ func DeleteSQL(b *Book, e *engine.Engine) error {
 		if err != nil {
 			return err
 		}
-		e.Scope.SQL = util.WrapTX(fmt.Sprintf(
+		e.Scope.SQL = dialects.WrapTX(e.Dialect, fmt.Sprintf(
 			"UPDATE %v SET deleted_at=%v%v%v",
 			scope.QuotedTableName(e, e.Scope.Value),
 			scope.AddToVars(e, e.Now()),
@@ -676,7 +1262,7 @@ func DeleteSQL(b *Book, e *engine.Engine) error {
 		if err != nil {
 			return err
 		}
-		e.Scope.SQL = util.WrapTX(fmt.Sprintf(
+		e.Scope.SQL = dialects.WrapTX(e.Dialect, fmt.Sprintf(
 			"DELETE FROM %v%v%v",
 			scope.QuotedTableName(e, e.Scope.Value),
 			util.AddExtraSpaceIfExist(c),
@@ -720,24 +1306,15 @@ func Delete(b *Book, e *engine.Engine) error {
 	if err != nil {
 		return err
 	}
-	tx, err := e.SQLDB.Begin()
+	result, err := ExecTx(e, e.Scope.SQL, e.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
-	result, err := tx.Exec(e.Scope.SQL, e.Scope.SQLVars...)
-	if err != nil {
-		_ = tx.Rollback()
-		return err
-	}
 	a, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 	e.RowsAffected = a
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
 	ad, ok := b.Delete.Get(model.AfterDelete)
 	if !ok {
 		return errors.New("missing after delete hook")
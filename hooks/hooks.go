@@ -69,6 +69,40 @@ type Book struct {
 	Query  *Hooks
 }
 
+var (
+	overridesMu sync.RWMutex
+	overrides   = make(map[string][]func(*Book))
+)
+
+//RegisterDialect registers fn to be called on the Book returned by DialectBook
+//for the dialect with the given name. This is how dialects override the
+//default hooks, for instance the ql dialects replace the AfterCreate hook
+//with QLAfterCreate in the package dialects/ql/hooks.
+//
+// Like dialects.Register this is expected to be called in the init function of
+// the package implementing the dialect.
+func RegisterDialect(name string, fn func(*Book)) {
+	if fn == nil {
+		panic("hooks: RegisterDialect fn is nil")
+	}
+	overridesMu.Lock()
+	overrides[name] = append(overrides[name], fn)
+	overridesMu.Unlock()
+}
+
+//DialectBook returns the default Book with the hooks registered for the
+//dialect name by RegisterDialect applied.
+func DialectBook(name string) *Book {
+	b := DefaultBook()
+	overridesMu.RLock()
+	fns := overrides[name]
+	overridesMu.RUnlock()
+	for _, fn := range fns {
+		fn(b)
+	}
+	return b
+}
+
 //DefaultBook returns the default ngorm Book. This has all default hooks set.
 func DefaultBook() *Book {
 	b := &Book{
@@ -84,13 +118,16 @@ func DefaultBook() *Book {
 	b.Create.Set(HookFunc(model.HookBeforeCreate, BeforeCreate))
 	b.Create.Set(HookFunc(model.HookCreateExec, CreateExec))
 	b.Create.Set(HookFunc(model.HookCreateSQL, CreateSQL))
+	b.Create.Set(HookFunc(model.HookCreateBatch, CreateBatch))
 	b.Create.Set(HookFunc(model.HookSaveBeforeAss, SaveBeforeAssociation))
+	b.Create.Set(HookFunc(model.HookSaveAfterAss, SaveAfterAssociation))
 
 	// Query hooks
 	b.Query.Set(HookFunc(model.Query, Query))
 	b.Query.Set(HookFunc(model.HookQueryExec, QueryExec))
 	b.Query.Set(HookFunc(model.HookQuerySQL, QuerySQL))
 	b.Query.Set(HookFunc(model.HookAfterQuery, AfterQuery))
+	b.Query.Set(HookFunc(model.HookQueryPreload, Preload))
 
 	// Update hooks
 	b.Update.Set(HookFunc(model.BeforeUpdate, BeforeUpdate))
@@ -98,6 +135,7 @@ func DefaultBook() *Book {
 	b.Update.Set(HookFunc(model.HookUpdateTimestamp, UpdateTimestamp))
 	b.Update.Set(HookFunc(model.HookAssignUpdatingAttrs, AssignUpdatingAttrs))
 	b.Update.Set(HookFunc(model.HookSaveBeforeAss, SaveBeforeAssociation))
+	b.Update.Set(HookFunc(model.HookSaveAfterAss, SaveAfterAssociation))
 	b.Update.Set(HookFunc(model.HookUpdateSQL, UpdateSQL))
 	b.Update.Set(HookFunc(model.HookUpdateExec, UpdateExec))
 	b.Update.Set(HookFunc(model.Update, Update))
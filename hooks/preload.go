@@ -0,0 +1,366 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gernest/ngorm/engine"
+	"github.com/gernest/ngorm/model"
+	"github.com/gernest/ngorm/scope"
+	"github.com/gernest/ngorm/search"
+	"github.com/gernest/ngorm/util"
+)
+
+//Preload loads associations that are listed in e.Search.Preload into the
+//query results. The results are taken from the model.QueryDestination scope
+//key if it is set, else e.Scope.Value is used.
+//
+//For every association one query is executed to fetch the related records
+//of all the results, the related records are then assigned to the matching
+//parents. many_to_many relationships need one more query on the join table.
+//
+//Nested associations are loaded by using dotted paths, for instance
+//Orders.Items.Product loads Orders of the results, Items of all the Orders
+//and Product of all the Items. Each level is loaded only once even if it
+//appears in more than one path. Conditions apply to the last level of the
+//path, a level that is also listed on its own uses its own conditions.
+func Preload(b *Book, e *engine.Engine) error {
+	if len(e.Search.Preload) == 0 {
+		return nil
+	}
+	root := e.Scope.Value
+	if dest, ok := e.Scope.Get(model.QueryDestination); ok {
+		root = dest
+	}
+	rootStruct, err := scope.GetModelStruct(e, root)
+	if err != nil {
+		return err
+	}
+	conditions := make(map[string][]interface{})
+	for _, p := range e.Search.Preload {
+		conditions[p.Schema] = p.Conditions
+	}
+	preloaded := make(map[string]bool)
+	for _, p := range e.Search.Preload {
+		value, m := root, rootStruct
+		parts := strings.Split(p.Schema, ".")
+		for idx, name := range parts {
+			field := preloadField(m, name)
+			if field == nil {
+				return fmt.Errorf("can't preload field %s for %s", name, m.ModelType)
+			}
+			rel := field.Relationship
+			if rel == nil {
+				return fmt.Errorf("%s is not a relationship of %s", name, m.ModelType)
+			}
+			key := strings.Join(parts[:idx+1], ".")
+			if !preloaded[key] {
+				c := conditions[key]
+				switch rel.Kind {
+				case "has_one":
+					err = preloadHasOne(b, e, value, field, c)
+				case "has_many":
+					err = preloadHasMany(b, e, value, field, c)
+				case "belongs_to":
+					err = preloadBelongsTo(b, e, value, field, c)
+				case "many_to_many":
+					err = preloadManyToMany(b, e, value, field, c)
+				default:
+					err = fmt.Errorf("unsupported relation %s for field %s", rel.Kind, name)
+				}
+				if err != nil {
+					return err
+				}
+				preloaded[key] = true
+			}
+			if idx < len(parts)-1 {
+				value = preloadChildren(value, field)
+				m, err = scope.GetModelStruct(e, value)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func preloadField(m *model.Struct, name string) *model.StructField {
+	for _, field := range m.StructFields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// preloadQuery fetches all records of the field's type whose columns match
+// the values in keys and returns the results as a slice.
+func preloadQuery(b *Book, e *engine.Engine, field *model.StructField, columns []string, keys [][]interface{}, conditions []interface{}) (reflect.Value, error) {
+	results := util.MakeSlice(field.Struct.Type)
+	ne := cloneEngine(e)
+	search.Where(ne, fmt.Sprintf("%v IN (%v)",
+		scope.ToQueryCondition(ne, columns), util.ToQueryMarks(keys)),
+		util.ToQueryValues(keys)...)
+	if rel := field.Relationship; rel.PolymorphicDBName != "" {
+		search.Where(ne, fmt.Sprintf("%v = ?",
+			scope.Quote(ne, rel.PolymorphicDBName)), rel.PolymorphicValue)
+	}
+	if len(conditions) > 0 {
+		search.Where(ne, conditions[0], conditions[1:]...)
+	}
+	ne.Scope.Value = results
+	q, ok := b.Query.Get(model.Query)
+	if !ok {
+		return reflect.Value{}, errors.New("missing query hook")
+	}
+	err := q.Exec(b, ne)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(results).Elem(), nil
+}
+
+func preloadHasOne(b *Book, e *engine.Engine, value interface{}, field *model.StructField, conditions []interface{}) error {
+	rel := field.Relationship
+	keys := scope.ColumnAsArray(rel.AssociationForeignFieldNames, value)
+	if len(keys) == 0 {
+		return nil
+	}
+	results, err := preloadQuery(b, e, field, rel.ForeignDBNames, keys, conditions)
+	if err != nil {
+		return err
+	}
+	parents := preloadParents(value)
+	for i := 0; i < results.Len(); i++ {
+		result := results.Index(i)
+		fk := util.GetValueFromFields(result, rel.ForeignFieldNames)
+		for _, parent := range parents {
+			if util.EqualAsString(util.GetValueFromFields(parent, rel.AssociationForeignFieldNames), fk) {
+				setPreloaded(fieldValue(parent, field), result)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func preloadHasMany(b *Book, e *engine.Engine, value interface{}, field *model.StructField, conditions []interface{}) error {
+	rel := field.Relationship
+	keys := scope.ColumnAsArray(rel.AssociationForeignFieldNames, value)
+	if len(keys) == 0 {
+		return nil
+	}
+	results, err := preloadQuery(b, e, field, rel.ForeignDBNames, keys, conditions)
+	if err != nil {
+		return err
+	}
+	parents := preloadParents(value)
+	for _, parent := range parents {
+		f := fieldValue(parent, field)
+		f.Set(reflect.MakeSlice(f.Type(), 0, 0))
+	}
+	for i := 0; i < results.Len(); i++ {
+		result := results.Index(i)
+		fk := util.GetValueFromFields(result, rel.ForeignFieldNames)
+		for _, parent := range parents {
+			if util.EqualAsString(util.GetValueFromFields(parent, rel.AssociationForeignFieldNames), fk) {
+				f := fieldValue(parent, field)
+				f.Set(reflect.Append(f, result))
+			}
+		}
+	}
+	return nil
+}
+
+func preloadBelongsTo(b *Book, e *engine.Engine, value interface{}, field *model.StructField, conditions []interface{}) error {
+	rel := field.Relationship
+	keys := scope.ColumnAsArray(rel.ForeignFieldNames, value)
+	if len(keys) == 0 {
+		return nil
+	}
+	results, err := preloadQuery(b, e, field, rel.AssociationForeignDBNames, keys, conditions)
+	if err != nil {
+		return err
+	}
+	parents := preloadParents(value)
+	for i := 0; i < results.Len(); i++ {
+		result := results.Index(i)
+		pk := util.GetValueFromFields(result, rel.AssociationForeignFieldNames)
+		for _, parent := range parents {
+			if util.EqualAsString(util.GetValueFromFields(parent, rel.ForeignFieldNames), pk) {
+				setPreloaded(fieldValue(parent, field), result)
+			}
+		}
+	}
+	return nil
+}
+
+func preloadManyToMany(b *Book, e *engine.Engine, value interface{}, field *model.StructField, conditions []interface{}) error {
+	rel := field.Relationship
+	j := rel.JoinTableHandler
+	if j == nil || len(j.Source.ForeignKeys) == 0 {
+		return fmt.Errorf("missing join table for field %s", field.Name)
+	}
+	parents := preloadParents(value)
+
+	// Collect the values of the join table source keys for every parent.
+	var keys [][]interface{}
+	sourceKeys := make([]string, len(parents))
+	for i, parent := range parents {
+		searchMap := scope.GetSearchMap(e, j, parent.Addr().Interface())
+		var key []interface{}
+		for _, fk := range j.Source.ForeignKeys {
+			key = append(key, searchMap[fk.DBName])
+		}
+		sourceKeys[i] = util.ToString(key)
+		if key[0] != nil && !util.IsBlank(reflect.ValueOf(key[0])) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// Query the join table for the keys pointing to the destination.
+	var columns []string
+	for _, fk := range j.Source.ForeignKeys {
+		columns = append(columns, scope.Quote(e, fk.DBName))
+	}
+	for _, fk := range j.Destination.ForeignKeys {
+		columns = append(columns, scope.Quote(e, fk.DBName))
+	}
+	ne := cloneEngine(e)
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE %v IN (%v)",
+		strings.Join(columns, ","), scope.Quote(ne, j.TableName),
+		scope.ToQueryCondition(ne, rel.ForeignDBNames),
+		scope.AddToVars(ne, &model.Expr{
+			Q: util.ToQueryMarks(keys), Args: util.ToQueryValues(keys)}))
+	rows, err := ne.SQLDB.QueryContext(ne.Ctx, query, ne.Scope.SQLVars...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	links := make(map[string][]string)
+	var destKeys [][]interface{}
+	seen := make(map[string]bool)
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		n := len(j.Source.ForeignKeys)
+		src, dest := util.ToString(values[:n]), util.ToString(values[n:])
+		links[src] = append(links[src], dest)
+		if !seen[dest] {
+			seen[dest] = true
+			destKeys = append(destKeys, values[n:])
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(destKeys) == 0 {
+		return nil
+	}
+
+	results, err := preloadQuery(b, e, field, rel.AssociationForeignFieldNames, destKeys, conditions)
+	if err != nil {
+		return err
+	}
+	dm, err := scope.GetModelStruct(e, reflect.New(field.Struct.Type).Interface())
+	if err != nil {
+		return err
+	}
+	var destNames []string
+	for _, name := range rel.AssociationForeignFieldNames {
+		if f := scope.GetForeignField(name, dm.StructFields); f != nil {
+			destNames = append(destNames, f.Name)
+		}
+	}
+	byKey := make(map[string][]reflect.Value)
+	for i := 0; i < results.Len(); i++ {
+		result := results.Index(i)
+		k := util.ToString(util.GetValueFromFields(result, destNames))
+		byKey[k] = append(byKey[k], result)
+	}
+	for i, parent := range parents {
+		f := fieldValue(parent, field)
+		f.Set(reflect.MakeSlice(f.Type(), 0, 0))
+		for _, dest := range links[sourceKeys[i]] {
+			for _, result := range byKey[dest] {
+				f.Set(reflect.Append(f, result))
+			}
+		}
+	}
+	return nil
+}
+
+// preloadChildren returns a pointer to a slice of pointers to all the
+// values of field that are held by the parents in value. This is used as the
+// parent value when preloading the next level of a nested path.
+func preloadChildren(value interface{}, field *model.StructField) interface{} {
+	elemType := field.Struct.Type
+	for elemType.Kind() == reflect.Slice || elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	children := reflect.New(reflect.SliceOf(reflect.PtrTo(elemType))).Elem()
+	add := func(v reflect.Value) {
+		if v.Kind() == reflect.Ptr {
+			if !v.IsNil() {
+				children.Set(reflect.Append(children, v))
+			}
+			return
+		}
+		children.Set(reflect.Append(children, v.Addr()))
+	}
+	for _, parent := range preloadParents(value) {
+		f := fieldValue(parent, field)
+		if f.Kind() == reflect.Slice {
+			for i := 0; i < f.Len(); i++ {
+				add(f.Index(i))
+			}
+			continue
+		}
+		add(f)
+	}
+	return children.Addr().Interface()
+}
+
+// preloadParents returns addressable struct values that are held by value.
+func preloadParents(value interface{}) []reflect.Value {
+	var parents []reflect.Value
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			if p := reflect.Indirect(v.Index(i)); p.IsValid() {
+				parents = append(parents, p)
+			}
+		}
+		return parents
+	}
+	return append(parents, v)
+}
+
+func fieldValue(parent reflect.Value, field *model.StructField) reflect.Value {
+	for _, name := range field.Names {
+		parent = reflect.Indirect(parent).FieldByName(name)
+	}
+	return parent
+}
+
+// setPreloaded sets dest to v, v is expected to be addressable when dest is a
+// pointer.
+func setPreloaded(dest, v reflect.Value) {
+	if dest.Kind() == reflect.Ptr && v.Kind() != reflect.Ptr {
+		dest.Set(v.Addr())
+		return
+	}
+	dest.Set(v)
+}
@@ -0,0 +1,280 @@
+//Package migrate applies versioned schema migrations and records the applied
+//versions in a history table.
+//
+// Unlike DB.Automigrate, which only adds the missing tables and columns, a
+// migration is an explicit, reviewable change with an up and a down step. The
+// steps are either SQL or Go functions.
+//
+//	m, err := migrate.New(db,
+//		migrate.Migration{
+//			Version: 1,
+//			Name:    "create users",
+//			UpSQL:   "CREATE TABLE users (id int64, name string);",
+//			DownSQL: "DROP TABLE users;",
+//		},
+//		migrate.Migration{
+//			Version: 2,
+//			Name:    "seed admin",
+//			Up: func(tx *ngorm.DB) error {
+//				return tx.Create(&User{Name: "admin"})
+//			},
+//		},
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	err = m.Apply()
+//
+// Each migration runs in its own transaction, together with the update of the
+// history table, so a failing migration leaves neither schema changes nor a
+// history row behind.
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gernest/ngorm"
+)
+
+//HistoryTable is the name of the table that stores the applied migrations.
+const HistoryTable = "schema_migrations"
+
+//Func is a migration step written in Go. tx is bound to the transaction of the
+//migration.
+type Func func(tx *ngorm.DB) error
+
+//Migration is a versioned change of the schema.
+type Migration struct {
+	// Version orders the migrations, it must be positive and unique.
+	Version int64
+	Name    string
+
+	// UpSQL and Up apply the migration, UpSQL is executed first when both are
+	// set. At least one of them is required.
+	UpSQL string
+	Up    Func
+
+	// DownSQL and Down revert the migration, Down is executed first when both
+	// are set. A migration without them can't be rolled back.
+	DownSQL string
+	Down    Func
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%d %s", m.Version, m.Name)
+}
+
+//History is a row of the history table.
+type History struct {
+	ID        int64
+	Version   int64
+	Name      string
+	AppliedAt time.Time
+}
+
+//TableName implements engine.Tabler.
+func (History) TableName() string {
+	return HistoryTable
+}
+
+//Status is the state of a migration.
+type Status struct {
+	Migration Migration
+	Applied   bool
+
+	// AppliedAt is the time the migration was applied, zero if it isn't.
+	AppliedAt time.Time
+}
+
+//Migrator applies and rolls back migrations on a database.
+type Migrator struct {
+	db         *ngorm.DB
+	migrations []Migration
+}
+
+//New returns a Migrator for the migrations, which are sorted by version. It
+//returns an error if a version is not positive or not unique, or if a migration
+//has no up step.
+func New(db *ngorm.DB, migrations ...Migration) (*Migrator, error) {
+	ms := make([]Migration, len(migrations))
+	copy(ms, migrations)
+	sort.Slice(ms, func(i, j int) bool {
+		return ms[i].Version < ms[j].Version
+	})
+	for i, m := range ms {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migrate: invalid version %d of %q", m.Version, m.Name)
+		}
+		if i > 0 && ms[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrate: duplicate version %d", m.Version)
+		}
+		if m.UpSQL == "" && m.Up == nil {
+			return nil, fmt.Errorf("migrate: migration %s has no up step", m)
+		}
+	}
+	return &Migrator{db: db, migrations: ms}, nil
+}
+
+//Apply applies the migrations that are not in the history table in version
+//order. It stops at the first migration that fails.
+func (m *Migrator) Apply() error {
+	applied, err := m.history()
+	if err != nil {
+		return err
+	}
+	for _, mg := range m.migrations {
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+		err = m.run(mg, true)
+		if err != nil {
+			return fmt.Errorf("migrate: applying %s: %v", mg, err)
+		}
+	}
+	return nil
+}
+
+//Rollback reverts the applied migrations with a version greater than version
+//in reverse version order, Rollback(0) reverts all of them. It returns an error
+//without reverting anything if one of them is unknown or has no down step.
+func (m *Migrator) Rollback(version int64) error {
+	applied, err := m.history()
+	if err != nil {
+		return err
+	}
+	known := make(map[int64]Migration)
+	for _, mg := range m.migrations {
+		known[mg.Version] = mg
+	}
+	var revert []Migration
+	for v := range applied {
+		if v <= version {
+			continue
+		}
+		mg, ok := known[v]
+		if !ok {
+			return fmt.Errorf("migrate: unknown applied version %d", v)
+		}
+		if mg.DownSQL == "" && mg.Down == nil {
+			return fmt.Errorf("migrate: migration %s has no down step", mg)
+		}
+		revert = append(revert, mg)
+	}
+	sort.Slice(revert, func(i, j int) bool {
+		return revert[i].Version > revert[j].Version
+	})
+	for _, mg := range revert {
+		err = m.run(mg, false)
+		if err != nil {
+			return fmt.Errorf("migrate: rolling back %s: %v", mg, err)
+		}
+	}
+	return nil
+}
+
+//Status returns the state of the migrations in version order. Applied
+//versions that are not among the migrations are included with only their
+//version and name set.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.history()
+	if err != nil {
+		return nil, err
+	}
+	var status []Status
+	for _, mg := range m.migrations {
+		s := Status{Migration: mg}
+		if h, ok := applied[mg.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = h.AppliedAt
+			delete(applied, mg.Version)
+		}
+		status = append(status, s)
+	}
+	for _, h := range applied {
+		status = append(status, Status{
+			Migration: Migration{Version: h.Version, Name: h.Name},
+			Applied:   true,
+			AppliedAt: h.AppliedAt,
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Migration.Version < status[j].Migration.Version
+	})
+	return status, nil
+}
+
+//Version returns the highest applied version, 0 if there is none.
+func (m *Migrator) Version() (int64, error) {
+	applied, err := m.history()
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+//history creates the history table if it doesn't exist and returns its rows
+//by version.
+func (m *Migrator) history() (map[int64]History, error) {
+	_, err := m.db.Begin().Automigrate(&History{})
+	if err != nil {
+		return nil, err
+	}
+	var rows []History
+	err = m.db.Begin().Find(&rows)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]History)
+	for _, h := range rows {
+		applied[h.Version] = h
+	}
+	return applied, nil
+}
+
+//run applies mg, or reverts it when up is false, and updates the history table
+//in one transaction. The SQL steps are executed with DB.ExecTx, which runs them
+//in the transaction.
+func (m *Migrator) run(mg Migration, up bool) error {
+	return m.db.Transaction(func(tx *ngorm.DB) error {
+		if up {
+			if mg.UpSQL != "" {
+				_, err := tx.ExecTx(mg.UpSQL)
+				if err != nil {
+					return err
+				}
+			}
+			if mg.Up != nil {
+				err := mg.Up(tx.Begin())
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Begin().Create(&History{
+				Version:   mg.Version,
+				Name:      mg.Name,
+				AppliedAt: time.Now().UTC(),
+			})
+		}
+		if mg.Down != nil {
+			err := mg.Down(tx.Begin())
+			if err != nil {
+				return err
+			}
+		}
+		if mg.DownSQL != "" {
+			_, err := tx.ExecTx(mg.DownSQL)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Begin().Delete(&History{}, "version = ?", mg.Version)
+	})
+}
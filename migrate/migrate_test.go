@@ -0,0 +1,182 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/cznic/ql/driver"
+	"github.com/gernest/ngorm"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMigrator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ngorm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	sources := []struct{ dialect, source string }{
+		{"ql-mem", "migrate.db"},
+		{"sqlite3", filepath.Join(dir, "migrate.db")},
+	}
+	for _, s := range sources {
+		db, err := ngorm.Open(s.dialect, s.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(db.Dialect().GetName(), func(ts *testing.T) {
+			testMigrator(ts, db)
+		})
+		_ = db.Close()
+	}
+}
+
+func testMigrator(t *testing.T, db *ngorm.DB) {
+	migrations := []Migration{
+		{
+			Version: 2,
+			Name:    "seed notes",
+			Up: func(tx *ngorm.DB) error {
+				_, err := tx.Exec("INSERT INTO notes (body) VALUES (?)", "hello")
+				return err
+			},
+			DownSQL: "DELETE FROM notes;",
+		},
+		{
+			Version: 1,
+			Name:    "create notes",
+			UpSQL:   "CREATE TABLE notes (body string);",
+			DownSQL: "DROP TABLE notes;",
+		},
+		{
+			Version: 3,
+			Name:    "create tags",
+			UpSQL:   "CREATE TABLE tags (name string);",
+			DownSQL: "DROP TABLE tags;",
+		},
+	}
+	m, err := New(db, migrations...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range status {
+		if s.Migration.Version != int64(i+1) || !s.Applied || s.AppliedAt.IsZero() {
+			t.Errorf("expected version %d to be applied got %+v", i+1, s)
+		}
+	}
+	var count int64
+	err = db.Begin().Raw("SELECT count(*) FROM notes").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 note got %d", count)
+	}
+
+	// applying again is a no-op.
+	err = m.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Rollback(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := m.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("expected version 1 got %d", version)
+	}
+	err = db.Begin().Raw("SELECT count(*) FROM notes").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected no notes got %d", count)
+	}
+
+	broken, err := New(db, append(migrations, Migration{
+		Version: 4,
+		Name:    "broken",
+		UpSQL:   "CREATE TABLE;",
+	})...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = broken.Apply()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	status, err = broken.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 4 || !status[2].Applied || status[3].Applied {
+		t.Errorf("expected versions 1 to 3 to be applied got %+v", status)
+	}
+
+	irreversible, err := New(db, migrations[0], migrations[1], Migration{
+		Version: 3,
+		Name:    "create tags",
+		UpSQL:   migrations[2].UpSQL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = irreversible.Rollback(0)
+	if err == nil {
+		t.Error("expected an error")
+	}
+	version, err = m.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 {
+		t.Errorf("expected version 3 got %d", version)
+	}
+	err = m.Rollback(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err = m.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 {
+		t.Errorf("expected version 0 got %d", version)
+	}
+}
+
+func TestNew(t *testing.T) {
+	up := "CREATE TABLE notes (body string);"
+	samples := []struct {
+		name       string
+		migrations []Migration
+	}{
+		{"zero version", []Migration{{Name: "a", UpSQL: up}}},
+		{"duplicate version", []Migration{
+			{Version: 1, Name: "a", UpSQL: up},
+			{Version: 1, Name: "b", UpSQL: up},
+		}},
+		{"missing up", []Migration{{Version: 1, Name: "a"}}},
+	}
+	for _, s := range samples {
+		_, err := New(nil, s.migrations...)
+		if err == nil {
+			t.Errorf("%s: expected an error", s.name)
+		}
+	}
+}
@@ -3,11 +3,17 @@
 package model
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/gernest/ngorm/errmsg"
 )
 
 // All important keys
@@ -20,6 +26,7 @@ const (
 	HookQuerySQL            = "ngorm:query_sql_hook"
 	HookQueryExec           = "ngorm:query_sql_exec"
 	HookAfterFindQuery      = "ngorm:query_after_find"
+	HookQueryPreload        = "ngorm:query_preload"
 	HookBeforeCreate        = "ngorm:before_create_hook"
 	HookBeforeSave          = "ngorm:before_save_hook"
 	Create                  = "ngorm:create"
@@ -31,9 +38,12 @@ const (
 	UpdateAttrs             = "ngorm:update_attrs"
 	TableOptions            = "ngorm:table_options"
 	HookSaveBeforeAss       = "ngorm:save_before_associations"
+	HookSaveAfterAss        = "ngorm:save_after_associations"
 	HookUpdateTimestamp     = "ngorm:update_time_stamp"
 	BlankColWithValue       = "ngorm:blank_columns_with_default_value"
 	InsertOptions           = "ngorm:insert_option"
+	OnConflict              = "ngorm:on_conflict"
+	BatchSize               = "ngorm:batch_size"
 	UpdateColumn            = "ngorm:update_column"
 	HookBeforeUpdate        = "ngorm:before_update_hook"
 	HookAfterUpdate         = "ngorm:after_update_hook"
@@ -42,6 +52,7 @@ const (
 	AfterUpdate             = "ngorm:after_update"
 	HookAssignUpdatingAttrs = "ngorm:assign_updating_attrs_hook"
 	HookCreateSQL           = "ngorm:create_sql"
+	HookCreateBatch         = "ngorm:create_batch"
 	UpdateOptions           = "ngorm:update_option"
 	Update                  = "ngorm:update"
 	HookUpdateSQL           = "ngorm:update_sql_hook"
@@ -55,6 +66,9 @@ const (
 	Delete                  = "ngorm:delete"
 	DeleteSQL               = "ngorm:delete_sql"
 	SaveAssociations        = "ngorm:save_associations"
+	AutomigrateDestructive  = "ngorm:automigrate_destructive"
+	SubQuery                = "ngorm:sub_query"
+	AssociationForeignKeys  = "ngorm:association_foreign_keys"
 )
 
 //Model defines common fields that are used for defining SQL Tables. This is a
@@ -202,6 +216,7 @@ type Scope struct {
 	SelectAttrs     *[]string
 	MultiExpr       bool
 	Exprs           []*Expr
+	Migration       *MigrationPlan
 	mu              sync.RWMutex
 	data            map[string]interface{}
 }
@@ -229,6 +244,13 @@ func (s *Scope) Get(key string) (interface{}, bool) {
 	return v, ok
 }
 
+//Delete removes the value with key from the scope.
+func (s *Scope) Delete(key string) {
+	s.mu.Lock()
+	delete(s.data, key)
+	s.mu.Unlock()
+}
+
 //GetAll erturns all values stored in this context.
 func (s *Scope) GetAll() map[string]interface{} {
 	s.mu.RLock()
@@ -242,14 +264,14 @@ func (s *Scope) GetAll() map[string]interface{} {
 
 //Search is the search level of SQL building
 type Search struct {
-	WhereConditions  []map[string]interface{}
-	OrConditions     []map[string]interface{}
-	NotConditions    []map[string]interface{}
-	HavingConditions []map[string]interface{}
-	JoinConditions   []map[string]interface{}
+	WhereConditions  []*Clause
+	OrConditions     []*Clause
+	NotConditions    []*Clause
+	HavingConditions []*Clause
+	JoinConditions   []*Clause
 	InitAttrs        []interface{}
 	AssignAttrs      []interface{}
-	Selects          map[string]interface{}
+	Selects          *Clause
 	Omits            []string
 	Orders           []interface{}
 	Preload          []SearchPreload
@@ -262,6 +284,14 @@ type Search struct {
 	IgnoreOrderQuery bool
 }
 
+//Clause is a search condition. Query is the condition, usually a string with
+//? placeholders for the positional values Args or a clause.Expression, see
+//builder.Where for all the supported types.
+type Clause struct {
+	Query interface{}
+	Args  []interface{}
+}
+
 //SearchPreload is the preload search condition.
 type SearchPreload struct {
 	Schema     string
@@ -269,21 +299,232 @@ type SearchPreload struct {
 }
 
 //SQLCommon is the interface for SQL database interactions.
+//
+// The methods accepting a context.Context abort the query when the context is
+// done. *sql.DB implements this interface.
 type SQLCommon interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 	Prepare(query string) (*sql.Stmt, error)
 	Query(query string, args ...interface{}) (*sql.Rows, error)
 	QueryRow(query string, args ...interface{}) *sql.Row
 	Begin() (*sql.Tx, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 	Close() error
 }
 
+//SQLTx is a SQLCommon that executes all queries inside the transaction Tx.
+type SQLTx struct {
+	*sql.Tx
+	savePoints int
+}
+
+//NextSavePoint returns a name for a new savepoint that is unique in the
+//transaction.
+func (s *SQLTx) NextSavePoint() string {
+	s.savePoints++
+	return fmt.Sprintf("ngorm_savepoint_%d", s.savePoints)
+}
+
+//Begin returns errmsg.ErrCantStartTransaction, the transaction is already
+//running.
+func (s *SQLTx) Begin() (*sql.Tx, error) {
+	return nil, errmsg.ErrCantStartTransaction
+}
+
+//BeginTx returns errmsg.ErrCantStartTransaction, the transaction is already
+//running.
+func (s *SQLTx) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return nil, errmsg.ErrCantStartTransaction
+}
+
+//Close does nothing. The transaction is ended by calling Commit or Rollback.
+func (s *SQLTx) Close() error {
+	return nil
+}
+
 // Expr is SQL expression
 type Expr struct {
 	Q    string
 	Args []interface{}
 }
 
+//Column is a column of a database table as reported by the database, see
+//dialects.Dialect.Columns.
+type Column struct {
+	Name     string
+	Type     string
+	Nullable bool
+
+	// Default is the default value expression of the column, HasDefault is
+	// false if the column has none.
+	Default    string
+	HasDefault bool
+}
+
+//Index is an index of a database table, as declared by the tags of a model or
+//reported by the database, see dialects.Dialect.Indexes.
+//
+// The databases only report the name, the columns and the uniqueness of their
+// indexes, the other fields are options of the declared indexes.
+type Index struct {
+	Name string
+
+	// Columns are the names of the columns, a column enclosed in parentheses
+	// is an SQL expression.
+	Columns []string
+	Unique  bool
+
+	// Sorts are the sort orders, ASC or DESC, of the Columns. An empty or a
+	// missing sort order is the default of the database.
+	Sorts []string
+
+	// Where is the predicate of a partial index.
+	Where string
+
+	// Type is the index method of the USING clause, like btree or gin.
+	Type string
+}
+
+//MigrationAction is the kind of change made by a MigrationStep.
+type MigrationAction string
+
+//The actions of the steps computed by scope.Automigrate.
+const (
+	CreateTable     MigrationAction = "create_table"
+	CreateJoinTable MigrationAction = "create_join_table"
+	AddColumn       MigrationAction = "add_column"
+	AlterColumn     MigrationAction = "alter_column"
+	DropColumn      MigrationAction = "drop_column"
+	AddIndex        MigrationAction = "add_index"
+	DropIndex       MigrationAction = "drop_index"
+	AddForeignKey   MigrationAction = "add_foreign_key"
+)
+
+//MigrationStep is a change of the schema of a table. Name is the name of the
+//column or the index that is changed, it is empty when the whole table is
+//created, and Detail describes the change.
+//
+// SQL is empty when the dialect can't express the change, like changing the
+// type of a column with sqlite, the step is then only reported.
+type MigrationStep struct {
+	Action      MigrationAction `json:"action"`
+	Table       string          `json:"table"`
+	Name        string          `json:"name,omitempty"`
+	Detail      string          `json:"detail,omitempty"`
+	SQL         string          `json:"sql"`
+	Destructive bool            `json:"destructive"`
+
+	// ForeignKey is the constraint added by an add_foreign_key step.
+	ForeignKey *ForeignKey `json:"foreign_key,omitempty"`
+}
+
+//Key identifies the object changed by the step, two steps with the same key
+//make the same change.
+func (s *MigrationStep) Key() string {
+	return string(s.Action) + " " + s.Table + " " + s.Name
+}
+
+func (s *MigrationStep) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString(string(s.Action) + " " + s.Table)
+	if s.Name != "" {
+		_, _ = buf.WriteString("." + s.Name)
+	}
+	if s.Detail != "" {
+		_, _ = buf.WriteString(": " + s.Detail)
+	}
+	if s.SQL == "" {
+		_, _ = buf.WriteString("\n\t-- not supported by the dialect")
+	} else {
+		_, _ = buf.WriteString("\n\t" + s.SQL + ";")
+	}
+	return buf.String()
+}
+
+//MigrationPlan is the list of the changes needed to make the database schema
+//match the models.
+//
+// Destructive steps can lose data or fail on existing rows, like dropping a
+// column, changing its type or making it NOT NULL. They are kept apart from the
+// safe ones and only executed when they are explicitly allowed.
+type MigrationPlan struct {
+	Safe        []*MigrationStep `json:"safe"`
+	Destructive []*MigrationStep `json:"destructive"`
+}
+
+//Add appends step to the safe or the destructive steps.
+func (p *MigrationPlan) Add(step *MigrationStep) {
+	if step.Destructive {
+		p.Destructive = append(p.Destructive, step)
+		return
+	}
+	p.Safe = append(p.Safe, step)
+}
+
+//Merge appends the steps of o that are not in p yet, see MigrationStep.Key.
+//Models sharing a join table both plan its creation for instance.
+//
+// The safe add_foreign_key steps are kept after the other safe steps, so the
+// constraints are added once all the tables of the plan are created.
+func (p *MigrationPlan) Merge(o *MigrationPlan) {
+	seen := make(map[string]bool)
+	for _, step := range p.Steps() {
+		seen[step.Key()] = true
+	}
+	for _, step := range o.Steps() {
+		if !seen[step.Key()] {
+			seen[step.Key()] = true
+			p.Add(step)
+		}
+	}
+	sort.SliceStable(p.Safe, func(i, j int) bool {
+		return p.Safe[i].Action != AddForeignKey && p.Safe[j].Action == AddForeignKey
+	})
+}
+
+//Steps returns the safe steps followed by the destructive ones.
+func (p *MigrationPlan) Steps() []*MigrationStep {
+	steps := make([]*MigrationStep, 0, len(p.Safe)+len(p.Destructive))
+	steps = append(steps, p.Safe...)
+	return append(steps, p.Destructive...)
+}
+
+//String renders the plan as text for review, one step per line followed by
+//its SQL.
+func (p *MigrationPlan) String() string {
+	var buf bytes.Buffer
+	write := func(title string, steps []*MigrationStep) {
+		_, _ = buf.WriteString(title + ":\n")
+		if len(steps) == 0 {
+			_, _ = buf.WriteString("  none\n")
+		}
+		for _, step := range steps {
+			_, _ = buf.WriteString("  " + strings.Replace(step.String(), "\n", "\n  ", -1) + "\n")
+		}
+	}
+	write("safe", p.Safe)
+	write("destructive", p.Destructive)
+	return buf.String()
+}
+
+//ForeignKey is a FOREIGN KEY constraint of Table, its Columns reference the
+//RefColumns of RefTable.
+type ForeignKey struct {
+	Name       string   `json:"name"`
+	Table      string   `json:"table"`
+	Columns    []string `json:"columns"`
+	RefTable   string   `json:"ref_table"`
+	RefColumns []string `json:"ref_columns"`
+
+	// OnDelete and OnUpdate are the referential actions, like CASCADE or SET
+	// NULL. The default of the database is used when they are empty.
+	OnDelete string `json:"on_delete,omitempty"`
+	OnUpdate string `json:"on_update,omitempty"`
+}
+
 //JoinTableForeignKey info that point to a key to use in join table.
 type JoinTableForeignKey struct {
 	DBName            string
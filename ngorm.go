@@ -64,6 +64,9 @@
 // Adopts to different SQL databases supported by ngorm. For now ngorm support
 // ql .
 //
+//   [migrate] https://godoc.org/github.com/gernest/ngorm/migrate
+// Versioned schema migrations, with up and down steps and a history table.
+//
 // Chaining
 //
 // The API supports methof chaining for a specific set of method.Be warned if
@@ -80,12 +83,17 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"strings"
 	"time"
 
 	"github.com/gernest/ngorm/builder"
+	"github.com/gernest/ngorm/clause"
 	"github.com/gernest/ngorm/dialects"
-	"github.com/gernest/ngorm/dialects/ql"
+	_ "github.com/gernest/ngorm/dialects/mssql"    // registers mssql dialect
+	_ "github.com/gernest/ngorm/dialects/mysql"    // registers mysql dialect
+	_ "github.com/gernest/ngorm/dialects/postgres" // registers postgres dialect
+	_ "github.com/gernest/ngorm/dialects/ql"       // registers ql and ql-mem dialects
+	_ "github.com/gernest/ngorm/dialects/ql/hooks" // registers ql and ql-mem hooks
+	_ "github.com/gernest/ngorm/dialects/sqlite"   // registers sqlite3 dialect
 	"github.com/gernest/ngorm/engine"
 	"github.com/gernest/ngorm/errmsg"
 	"github.com/gernest/ngorm/hooks"
@@ -117,6 +125,9 @@ type DB struct {
 	e             *engine.Engine
 	err           error
 	now           func() time.Time
+
+	// savePoint is the name of the savepoint that this instance is bound to.
+	savePoint string
 }
 
 func (db *DB) clone() *DB {
@@ -130,6 +141,7 @@ func (db *DB) clone() *DB {
 		hooks:         db.hooks,
 		log:           db.log,
 		now:           time.Now,
+		savePoint:     db.savePoint,
 	}
 	ne := n.NewEngine()
 	n.e = ne
@@ -146,10 +158,17 @@ func (db *DB) clone() *DB {
 // library,
 //
 //   * ql https://github.com/cznic/ql
+//   * sqlite3 https://github.com/mattn/go-sqlite3
+//   * postgres https://github.com/lib/pq
+//   * mysql https://github.com/go-sql-driver/mysql
+//   * mssql https://github.com/denisenkom/go-mssqldb
 //
 // The drivers for the libraries must be imported inside your application in the
 // same package as you invoke this function.
 //
+// Other dialects can be added with dialects.Register, and they can override
+// the default hooks with hooks.RegisterDialect.
+//
 // Example
 //
 //   import _ "github.com/cznic/ql/driver"  // imports ql driver
@@ -174,13 +193,8 @@ func OpenWithOpener(opener Opener, dialect string, args ...interface{}) (*DB, er
 		zap.NewTextEncoder(zap.TextNoTime()), // drop timestamps in tests
 	)
 	ctx, cancel := context.WithCancel(context.Background())
-	h := hooks.DefaultBook()
-	switch dia.GetName() {
-	case "ql", "ql-mem":
-		h.Create.Set(
-			hooks.HookFunc(model.AfterCreate, hooks.QLAfterCreate),
-		)
-	}
+	dia.SetContext(ctx)
+	h := hooks.DialectBook(dia.GetName())
 	return &DB{
 		db:        db,
 		dialect:   dia,
@@ -208,60 +222,63 @@ func (db *DB) NewEngine() *engine.Engine {
 }
 
 //CreateTable creates new database tables that maps to the models.
+//
+// For dialects that need it the statements are executed as a single query in a
+// TRANSACTION block, like ql. Otherwise they are executed one by one in a
+// transaction.
 func (db *DB) CreateTable(models ...interface{}) (sql.Result, error) {
-	query, err := db.CreateTableSQL(models...)
+	if dialects.NeedsTX(db.dialect) {
+		query, err := db.CreateTableSQL(models...)
+		if err != nil {
+			return nil, err
+		}
+		return db.ExecTx(query.Q, query.Args...)
+	}
+	plan, err := db.plan(scope.CreateTable, models...)
 	if err != nil {
 		return nil, err
 	}
-	return db.ExecTx(query.Q, query.Args...)
+	return db.execSteps(plan.Safe)
+}
+
+//execSteps executes the SQL of the steps one by one in a transaction.
+func (db *DB) execSteps(steps []*model.MigrationStep) (sql.Result, error) {
+	var queries []string
+	for _, step := range steps {
+		if step.SQL != "" {
+			queries = append(queries, step.SQL)
+		}
+	}
+	return hooks.ExecStepsTx(db.NewEngine(), queries...)
 }
 
 //ExecTx wraps the query execution in a Transaction. This ensure all operations
 //are Rolled back in case the execution fials.
+//
+// When db is bound to a transaction(see Tx) the query is executed in that
+// transaction instead.
 func (db *DB) ExecTx(query string, args ...interface{}) (sql.Result, error) {
-	tx, err := db.db.Begin()
-	if err != nil {
-		return nil, err
-	}
-	r, err := tx.Exec(query, args...)
-	if err != nil {
-		_ = tx.Rollback()
-		return nil, err
-	}
-	err = tx.Commit()
-	if err != nil {
-		return nil, err
-	}
-	return r, nil
+	return hooks.ExecTx(db.NewEngine(), query, args...)
 }
 
 //CreateTableSQL return the sql query for creating tables for all the given
-//models. The queries are wrapped in a TRANSACTION block.
+//models. The queries are wrapped in a TRANSACTION block for dialects that need
+//it, like ql.
 func (db *DB) CreateTableSQL(models ...interface{}) (*model.Expr, error) {
-	var scopeVars map[string]interface{}
-	if db.e != nil {
-		scopeVars = db.e.Scope.GetAll()
+	plan, err := db.plan(scope.CreateTable, models...)
+	if err != nil {
+		return nil, err
 	}
 	var buf bytes.Buffer
-	_, _ = buf.WriteString("BEGIN TRANSACTION; \n")
-	for _, m := range models {
-		e := db.NewEngine()
-		for k, v := range scopeVars {
-			e.Scope.Set(k, v)
-		}
-		// Firste we generate the SQL
-		err := scope.CreateTable(e, m)
-		if err != nil {
-			return nil, err
-		}
-		_, _ = buf.WriteString("\t" + e.Scope.SQL + ";\n")
-		if e.Scope.MultiExpr {
-			for _, expr := range e.Scope.Exprs {
-				_, _ = buf.WriteString("\t" + expr.Q + ";\n")
-			}
-		}
+	if dialects.NeedsTX(db.dialect) {
+		_, _ = buf.WriteString("BEGIN TRANSACTION; \n")
+	}
+	for _, step := range plan.Safe {
+		_, _ = buf.WriteString("\t" + step.SQL + ";\n")
+	}
+	if dialects.NeedsTX(db.dialect) {
+		_, _ = buf.WriteString("COMMIT;")
 	}
-	_, _ = buf.WriteString("COMMIT;")
 	return &model.Expr{Q: buf.String()}, nil
 }
 
@@ -269,7 +286,8 @@ func (db *DB) CreateTableSQL(models ...interface{}) (*model.Expr, error) {
 type DefaultOpener struct {
 }
 
-//Open opens up database connection using the database/sql package.
+//Open opens up database connection using the database/sql package. The dialect
+//must be registered with dialects.Register.
 func (d *DefaultOpener) Open(dialect string, args ...interface{}) (model.SQLCommon, dialects.Dialect, error) {
 	var source string
 	var dia dialects.Dialect
@@ -294,22 +312,20 @@ func (d *DefaultOpener) Open(dialect string, args ...interface{}) (model.SQLComm
 	default:
 		return nil, nil, fmt.Errorf("unknown argument %v", value)
 	}
-	switch dialect {
-	case "ql":
-		dia = ql.File()
-	case "ql-mem":
-		dia = ql.Memory()
-	default:
-		return nil, nil, fmt.Errorf("unsupported dialect %s", dialect)
+	dia, err = dialects.Open(dialect)
+	if err != nil {
+		return nil, nil, err
 	}
 	return common, dia, nil
 }
 
 //DropTableSQL generates sql query for DROP TABLE. The generated query is
-//wrapped under TRANSACTION block.
+//wrapped under TRANSACTION block for dialects that need it, like ql.
 func (db *DB) DropTableSQL(models ...interface{}) (*model.Expr, error) {
 	var buf bytes.Buffer
-	_, _ = buf.WriteString("BEGIN TRANSACTION; \n")
+	if dialects.NeedsTX(db.dialect) {
+		_, _ = buf.WriteString("BEGIN TRANSACTION; \n")
+	}
 	for _, m := range models {
 		e := db.NewEngine()
 		if n, ok := m.(string); ok {
@@ -322,7 +338,9 @@ func (db *DB) DropTableSQL(models ...interface{}) (*model.Expr, error) {
 		}
 		_, _ = buf.WriteString("\t" + e.Scope.SQL + ";\n")
 	}
-	_, _ = buf.WriteString("COMMIT;")
+	if dialects.NeedsTX(db.dialect) {
+		_, _ = buf.WriteString("COMMIT;")
+	}
 	return &model.Expr{Q: buf.String()}, nil
 }
 
@@ -339,53 +357,167 @@ func (db *DB) DropTable(models ...interface{}) (sql.Result, error) {
 //Automigrate creates tables that map to models if the tables don't exist yet in
 //the database. This also takes care of situation where the models's fields have
 //been updated(changed)
+//
+// Only the safe changes are applied by default. Dropping columns and indexes,
+// changing the type of columns and making them NOT NULL are applied when they
+// are explicitly allowed, see scope.Automigrate.
+//
+//	db.Set(model.AutomigrateDestructive, true).Automigrate(&User{})
+//
+// Foreign key constraints are created for the belongs_to, has_one, has_many
+// and many_to_many relationships of the models. Their ON DELETE and ON UPDATE
+// actions are set with the CONSTRAINT tag, CONSTRAINT:false disables them.
+//
+// The has_one and has_many constraints are on the table of the associated
+// model, migrate both models with the same call to create them with that
+// table. With sqlite they are not created otherwise, as it can't add
+// constraints to existing tables, and with the other dialects adding them to
+// the existing table is a destructive step.
+//
+//	type Post struct {
+//		ID       int64
+//		Author   Author `gorm:"CONSTRAINT:OnDelete:CASCADE,OnUpdate:CASCADE"`
+//		AuthorID int64
+//	}
+//
+// Like CreateTable, the statements are executed one by one in a transaction
+// for dialects that don't need a TRANSACTION block.
 func (db *DB) Automigrate(models ...interface{}) (sql.Result, error) {
-	query, err := db.AutomigrateSQL(models...)
+	if dialects.NeedsTX(db.dialect) {
+		query, err := db.AutomigrateSQL(models...)
+		if err != nil {
+			return nil, err
+		}
+		return db.ExecTx(query.Q, query.Args...)
+	}
+	steps, err := db.automigrateSteps(models...)
 	if err != nil {
 		return nil, err
 	}
-	return db.ExecTx(query.Q, query.Args...)
+	return db.execSteps(steps)
 }
 
-//AutomigrateSQL generates sql query for running migrations on models.
+//automigrateSteps returns the steps of MigrationPlan that Automigrate applies.
+func (db *DB) automigrateSteps(models ...interface{}) ([]*model.MigrationStep, error) {
+	plan, err := db.MigrationPlan(models...)
+	if err != nil {
+		return nil, err
+	}
+	if db.e != nil {
+		if allow, _ := db.e.Scope.Get(model.AutomigrateDestructive); allow == true {
+			return plan.Steps(), nil
+		}
+	}
+	return plan.Safe, nil
+}
+
+//AutomigrateSQL generates sql query for running migrations on models. It is
+//the SQL of the steps of MigrationPlan, the destructive steps are included when
+//they are allowed.
 func (db *DB) AutomigrateSQL(models ...interface{}) (*model.Expr, error) {
+	steps, err := db.automigrateSteps(models...)
+	if err != nil {
+		return nil, err
+	}
 	var buf bytes.Buffer
-	_, _ = buf.WriteString("BEGIN TRANSACTION;\n")
-	keys := make(map[string]bool)
+	if dialects.NeedsTX(db.dialect) {
+		_, _ = buf.WriteString("BEGIN TRANSACTION;\n")
+	}
+	for _, step := range steps {
+		if step.SQL != "" {
+			_, _ = buf.WriteString("\t" + step.SQL + ";\n")
+		}
+	}
+	if dialects.NeedsTX(db.dialect) {
+		_, _ = buf.WriteString("COMMIT;")
+	}
+	return &model.Expr{Q: buf.String()}, nil
+}
+
+//MigrationPlan returns the changes Automigrate would make to the database for
+//the models, without making them. Each step has the exact SQL that is executed
+//for it, the plan can be reviewed as text with its String method or encoded as
+//JSON.
+//
+//	plan, err := db.MigrationPlan(&User{}, &Language{})
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(plan)
+//
+// A join table shared by models is created once, see model.MigrationPlan.Merge.
+func (db *DB) MigrationPlan(models ...interface{}) (*model.MigrationPlan, error) {
+	return db.plan(scope.Automigrate, models...)
+}
+
+//plan merges the plans that build stores in e.Scope.Migration for the models.
+//
+// The has_one and has_many constraints of the models are set on the scope with
+// the key model.AssociationForeignKeys, so the associated models that are
+// migrated with them plan the constraints on their tables.
+//
+// The foreign keys on, or referencing, a table that neither exists nor is
+// created by the plan are left out. They are planned by a later migration of
+// the model, once the table exists.
+func (db *DB) plan(build func(*engine.Engine, interface{}) error, models ...interface{}) (*model.MigrationPlan, error) {
+	var scopeVars map[string]interface{}
+	if db.e != nil {
+		scopeVars = db.e.Scope.GetAll()
+	}
+	var assoc []*model.ForeignKey
+	for _, m := range models {
+		fks, err := scope.AssociationForeignKeys(db.NewEngine(), m)
+		if err != nil {
+			return nil, err
+		}
+		assoc = append(assoc, fks...)
+	}
+	plan := &model.MigrationPlan{}
 	for _, m := range models {
 		e := db.NewEngine()
-
-		// Firste we generate the SQL
-		err := scope.Automigrate(e, m)
+		for k, v := range scopeVars {
+			e.Scope.Set(k, v)
+		}
+		e.Scope.Set(model.AssociationForeignKeys, assoc)
+		err := build(e, m)
 		if err != nil {
 			return nil, err
 		}
-		if e.Scope.SQL != "" {
-			i := strings.Index(e.Scope.SQL, "(")
-			k := e.Scope.SQL[:i]
-			if _, ok := keys[k]; !ok {
-				_, _ = buf.WriteString("\t" + e.Scope.SQL + ";\n")
-				keys[k] = true
-			}
+		plan.Merge(e.Scope.Migration)
+	}
+	created := make(map[string]bool)
+	for _, step := range plan.Safe {
+		if step.Action == model.CreateTable || step.Action == model.CreateJoinTable {
+			created[step.Table] = true
 		}
-		if e.Scope.MultiExpr {
-			for _, expr := range e.Scope.Exprs {
-				i := strings.Index(expr.Q, "(")
-				k := expr.Q[:i]
-				if _, ok := keys[k]; !ok {
-					_, _ = buf.WriteString("\t" + expr.Q + ";\n")
-					keys[k] = true
-				}
+	}
+	missing := func(tableName string) bool {
+		return !created[tableName] && !db.dialect.HasTable(tableName)
+	}
+	keep := func(steps []*model.MigrationStep) []*model.MigrationStep {
+		var kept []*model.MigrationStep
+		for _, step := range steps {
+			if fk := step.ForeignKey; fk != nil && (missing(fk.Table) || missing(fk.RefTable)) {
+				continue
 			}
+			kept = append(kept, step)
 		}
+		return kept
 	}
-	_, _ = buf.WriteString("COMMIT;")
-	return &model.Expr{Q: buf.String()}, nil
+	plan.Safe = keep(plan.Safe)
+	plan.Destructive = keep(plan.Destructive)
+	return plan, nil
 }
 
 //Close closes the database connection and sends Done signal across all
 //goroutines that subscribed to this instance context.
+//
+// Close does nothing when db is bound to a transaction, the transaction is
+// ended with Commit or Rollback.
 func (db *DB) Close() error {
+	if _, ok := db.db.(*model.SQLTx); ok {
+		return nil
+	}
 	db.cancel()
 	return db.db.Close()
 }
@@ -394,7 +526,31 @@ func (db *DB) Close() error {
 //
 // You can hijack the execution of the generated SQL by overiding
 // model.HookCreateExec hook.
+//
+// The has_one, has_many and many_to_many associations of value are saved after
+// the record is created by the hook registered with key model.HookSaveAfterAss.
+// The record and its associations are saved in a transaction, unless db is
+// already bound to one.
+//
+// When value is a slice all its records are created in a transaction, with
+// multi-row INSERT statements if the dialect supports them, see CreateInBatches
+// and hooks.CreateBatch.
 func (db *DB) Create(value interface{}) error {
+	if reflect.Indirect(reflect.ValueOf(value)).Kind() == reflect.Slice {
+		return db.createBatch(value)
+	}
+	if db.needsAssociationTx(value) {
+		return db.inTx(func(tx *DB) error {
+			return tx.Create(value)
+		})
+	}
+	if db.e != nil {
+		if v, ok := db.e.Scope.Get(model.OnConflict); ok {
+			if _, ok := db.dialect.(dialects.Upserter); !ok {
+				return db.upsert(value, v.(clause.OnConflict))
+			}
+		}
+	}
 	sql, err := db.CreateSQL(value)
 	if err != nil {
 		return err
@@ -404,6 +560,11 @@ func (db *DB) Create(value interface{}) error {
 		return errors.New("missing execution hook")
 	}
 	e := db.NewEngine()
+	if db.e != nil {
+		for k, v := range db.e.Scope.GetAll() {
+			e.Scope.Set(k, v)
+		}
+	}
 	e.Scope.Value = value
 	e.Scope.SQL = sql.Q
 	e.Scope.SQLVars = sql.Args
@@ -412,11 +573,213 @@ func (db *DB) Create(value interface{}) error {
 		return err
 	}
 	if ac, ok := db.hooks.Create.Get(model.AfterCreate); ok {
-		return ac.Exec(db.hooks, e)
+		err = ac.Exec(db.hooks, e)
+		if err != nil {
+			return err
+		}
+	}
+	if scope.ShouldSaveAssociation(e) {
+		if sa, ok := db.hooks.Create.Get(model.HookSaveAfterAss); ok {
+			return sa.Exec(db.hooks, e)
+		}
 	}
 	return nil
 }
 
+//needsAssociationTx returns true if the associations of value are saved with
+//it and db is not bound to a transaction.
+func (db *DB) needsAssociationTx(value interface{}) bool {
+	if _, ok := db.db.(*model.SQLTx); ok {
+		return false
+	}
+	e := db.NewEngine()
+	if db.e != nil {
+		for k, v := range db.e.Scope.GetAll() {
+			e.Scope.Set(k, v)
+		}
+	}
+	if !scope.ShouldSaveAssociation(e) {
+		return false
+	}
+	m, err := scope.GetModelStruct(e, value)
+	if err != nil {
+		return false
+	}
+	for _, field := range m.StructFields {
+		if field.Relationship != nil {
+			return true
+		}
+	}
+	return false
+}
+
+//inTx calls fn with a copy of db bound to a new transaction, the scope
+//settings of db are copied too.
+func (db *DB) inTx(fn func(tx *DB) error) error {
+	var data map[string]interface{}
+	if db.e != nil {
+		data = db.e.Scope.GetAll()
+	}
+	return db.Transaction(func(tx *DB) error {
+		for k, v := range data {
+			tx.e.Scope.Set(k, v)
+		}
+		return fn(tx)
+	})
+}
+
+//CreateInBatches is like Create for the slice value, inserting at most size
+//records with each statement.
+//
+//	err := db.CreateInBatches(&users, 500)
+func (db *DB) CreateInBatches(value interface{}, size int) error {
+	if size <= 0 {
+		return fmt.Errorf("invalid batch size %d", size)
+	}
+	return db.Set(model.BatchSize, size).Create(value)
+}
+
+//createBatch creates the records of the slice value in a transaction, with the
+//hook registered with the key model.HookCreateBatch. The records are upserted
+//one at a time when the clause.OnConflict option is set.
+func (db *DB) createBatch(value interface{}) error {
+	var data map[string]interface{}
+	if db.e != nil {
+		data = db.e.Scope.GetAll()
+	}
+	run := func(tx *DB) error {
+		if v, ok := data[model.OnConflict]; ok {
+			records := reflect.Indirect(reflect.ValueOf(value))
+			for i := 0; i < records.Len(); i++ {
+				record := records.Index(i)
+				if record.Kind() != reflect.Ptr {
+					record = record.Addr()
+				}
+				err := tx.Begin().Clauses(v.(clause.OnConflict)).Create(record.Interface())
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		c, ok := db.hooks.Create.Get(model.HookCreateBatch)
+		if !ok {
+			return errors.New("missing create batch hook")
+		}
+		e := tx.NewEngine()
+		for k, v := range data {
+			e.Scope.Set(k, v)
+		}
+		e.Scope.Value = value
+		return c.Exec(db.hooks, e)
+	}
+	if _, ok := db.db.(*model.SQLTx); ok {
+		return run(db)
+	}
+	return db.Transaction(run)
+}
+
+//upsert is Create with a clause.OnConflict option for dialects that don't
+//implement dialects.Upserter. The row conflicting with value is looked up in a
+//transaction, value is inserted if there is none, otherwise the DoUpdates
+//columns of the row are updated and the primary key of value is set.
+func (db *DB) upsert(value interface{}, oc clause.OnConflict) error {
+	e := db.NewEngine()
+	columns := oc.Columns
+	if len(columns) == 0 {
+		fields, err := scope.PrimaryFields(e, value)
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			columns = append(columns, field.DBName)
+		}
+	}
+	where := make(map[string]interface{})
+	for _, column := range columns {
+		field, err := scope.FieldByName(e, value, column)
+		if err != nil {
+			return err
+		}
+		if field.IsBlank && field.IsPrimaryKey {
+			// A blank primary key is generated by the database, so it
+			// can't conflict with an existing row.
+			where = nil
+			break
+		}
+		where[field.DBName] = field.Field.Interface()
+	}
+	run := func(tx *DB) error {
+		if where == nil {
+			return tx.Begin().Create(value)
+		}
+		existing := reflect.New(reflect.Indirect(reflect.ValueOf(value)).Type())
+		err := tx.Begin().Where(where).First(existing.Interface())
+		if err == errmsg.ErrRecordNotFound {
+			return tx.Begin().Create(value)
+		}
+		if err != nil {
+			return err
+		}
+		pk, err := scope.PrimaryField(e, existing.Interface())
+		if err != nil {
+			return err
+		}
+		if pk != nil {
+			field, err := scope.FieldByName(e, value, pk.Name)
+			if err != nil {
+				return err
+			}
+			if err = field.Set(pk.Field.Interface()); err != nil {
+				return err
+			}
+		}
+		if len(oc.DoUpdates) == 0 {
+			return nil
+		}
+		updates := make(map[string]interface{})
+		for _, column := range oc.DoUpdates {
+			field, err := scope.FieldByName(e, value, column)
+			if err != nil {
+				return err
+			}
+			updates[field.DBName] = field.Field.Interface()
+		}
+		return tx.Begin().Model(value).Updates(updates)
+	}
+	if _, ok := db.db.(*model.SQLTx); ok {
+		return run(db)
+	}
+	return db.Transaction(run)
+}
+
+//Clauses sets the options of the statement built by the next query. The only
+//option is clause.OnConflict, which turns Create into an upsert.
+//
+// Dialects implementing dialects.Upserter update the conflicting row in the
+// INSERT statement itself, for the others the row is looked up and then
+// inserted or updated in a transaction.
+//
+// The options are set on a copy of db, so db itself is left unchanged.
+func (db *DB) Clauses(options ...clause.Option) *DB {
+	ndb := db.clone()
+	if db.e != nil {
+		s := *db.e.Search
+		ndb.e.Search = &s
+		for k, v := range db.e.Scope.GetAll() {
+			ndb.e.Scope.Set(k, v)
+		}
+		ndb.e.Scope.Value = db.e.Scope.Value
+	}
+	for _, option := range options {
+		switch o := option.(type) {
+		case clause.OnConflict:
+			ndb.Set(model.OnConflict, o)
+		}
+	}
+	return ndb
+}
+
 //CreateSQL generates SQl query for creating a new record/records for value. This
 //uses Hooks to allow more flexibility.
 //
@@ -449,7 +812,8 @@ func (db *DB) Create(value interface{}) error {
 // All the other hooks apart from model.Create should write SQQL gerries in
 // e.Scope.Epxrs only model.Create hook should write to e.Scope.SQL.
 //
-// The end query is wrapped under TRANSACTION block.
+// The end query is wrapped under TRANSACTION block for dialects that need it,
+// like ql.
 func (db *DB) CreateSQL(value interface{}) (*model.Expr, error) {
 	var e *engine.Engine
 	if db.e != nil {
@@ -494,7 +858,15 @@ func (db *DB) SaveSQL(value interface{}) (*model.Expr, error) {
 }
 
 // Save update value in database, if the value doesn't have primary key, will insert it
+//
+// Like Create, value and its associations are saved in a transaction unless db
+// is already bound to one.
 func (db *DB) Save(value interface{}) error {
+	if db.needsAssociationTx(value) {
+		return db.inTx(func(tx *DB) error {
+			return tx.Save(value)
+		})
+	}
 	e := db.NewEngine()
 	e.Scope.Value = value
 	field, _ := scope.PrimaryField(e, value)
@@ -722,6 +1094,352 @@ func (db *DB) Find(out interface{}, where ...interface{}) error {
 	return q.Exec(db.hooks, db.e)
 }
 
+//Raw sets query as the SQL to run with Scan or Rows, args are the positional
+//values of query. Like in Where a single map[string]interface{} or struct can
+//be used to bind @name parameters.
+//
+//	var users []User
+//	err := db.Raw("SELECT * FROM users WHERE age > @age", map[string]interface{}{
+//		"age": 18,
+//	}).Scan(&users)
+func (db *DB) Raw(query string, args ...interface{}) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.Raw(db.e, true)
+	search.Where(db.e, query, args...)
+	return db
+}
+
+//Scan executes the query and scans the results into dest. The query is the one
+//set by Raw, otherwise it is built from the model set by DB.Model and the
+//conditions.
+//
+// dest can be a pointer to any struct, not only a model, or to a slice of
+// structs. A pointer to a map[string]interface{} or a
+// []map[string]interface{} gets the columns of the rows as keys, any other
+// pointer is scanned with the first row.
+func (db *DB) Scan(dest interface{}) error {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	modelValue := db.e.Scope.Value
+	if modelValue == nil {
+		modelValue = dest
+	}
+	sql, err := builder.PrepareQuerySQL(db.e, modelValue)
+	if err != nil {
+		return err
+	}
+	if str, ok := db.e.Scope.Get(model.QueryOption); ok {
+		sql += util.AddExtraSpaceIfExist(fmt.Sprint(str))
+	}
+	switch dest.(type) {
+	case *map[string]interface{}, *[]map[string]interface{}:
+		return db.scanMaps(sql, db.e.Scope.SQLVars, dest)
+	}
+	t := reflect.TypeOf(dest)
+	if t.Kind() != reflect.Ptr {
+		return errmsg.ErrUnaddressable
+	}
+	t = t.Elem()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return db.SQLCommon().QueryRowContext(db.ctx, sql, db.e.Scope.SQLVars...).Scan(dest)
+	}
+	exec, ok := db.hooks.Query.Get(model.HookQueryExec)
+	if !ok {
+		return errors.New("missing query exec hook")
+	}
+	e := db.NewEngine()
+	e.Scope.Value = dest
+	e.Scope.SQL = sql
+	e.Scope.SQLVars = db.e.Scope.SQLVars
+	return exec.Exec(db.hooks, e)
+}
+
+// scanMaps executes query and scans the rows into dest which is either a
+// *map[string]interface{} or a *[]map[string]interface{}.
+func (db *DB) scanMaps(query string, args []interface{}, dest interface{}) error {
+	rows, err := db.SQLCommon().QueryContext(db.ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	var results []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		m := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			m[column] = values[i]
+		}
+		results = append(results, m)
+		if _, ok := dest.(*map[string]interface{}); ok {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	switch d := dest.(type) {
+	case *map[string]interface{}:
+		if len(results) == 0 {
+			return errmsg.ErrRecordNotFound
+		}
+		*d = results[0]
+	case *[]map[string]interface{}:
+		*d = results
+	}
+	return nil
+}
+
+//Exec executes query with the positional values args and returns the result.
+//Like in Raw a single map[string]interface{} or struct can be used to bind
+//@name parameters. The query is executed in a transaction.
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	e := db.NewEngine()
+	search.Raw(e, true)
+	search.Where(e, query, args...)
+	q, err := builder.PrepareQuerySQL(e, nil)
+	if err != nil {
+		return nil, err
+	}
+	return hooks.ExecTx(e, dialects.WrapTX(e.Dialect, q), e.Scope.SQLVars...)
+}
+
+//SubQuery returns the query built on db as an expression that can be used as
+//a positional value of other queries. The SQL and the values of the sub query
+//are merged into the outer query, with the placeholders renumbered for the
+//dialect.
+//
+//	sub, err := db.Model(&Order{}).Select("user_id").Where("amount > ?", 100).SubQuery()
+//	if err != nil {
+//		return err
+//	}
+//	err = db.Begin().Where("id IN (?)", sub).Find(&users)
+func (db *DB) SubQuery() (*model.Expr, error) {
+	if db.e == nil || db.e.Scope.Value == nil && !db.e.Search.Raw {
+		return nil, errors.New("missing model, before calling this startwith db.Model")
+	}
+	sql, ok := db.hooks.Query.Get(model.HookQuerySQL)
+	if !ok {
+		return nil, errors.New("missing query sql hook")
+	}
+
+	// The query is built with ? placeholders, they are replaced with the
+	// placeholders of the outer query by scope.AddToVars.
+	db.e.Scope.Set(model.SubQuery, true)
+	defer db.e.Scope.Delete(model.SubQuery)
+	db.e.Scope.SQLVars = nil
+	err := sql.Exec(db.hooks, db.e)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Expr{Q: db.e.Scope.SQL, Args: db.e.Scope.SQLVars}, nil
+}
+
+//Rows executes the query set by Raw or for the model set by DB.Model and
+//returns the resulting *sql.Rows. Unlike Find the rows are not loaded in
+//memory, use ScanRows to scan each row into a model.
+//
+//	rows, err := db.Model(&User{}).Where("age > ?", 18).Rows()
+//	if err != nil {
+//		return err
+//	}
+//	defer rows.Close()
+//	for rows.Next() {
+//		var user User
+//		err = db.ScanRows(rows, &user)
+//		...
+//	}
+//
+// Closing the rows is left to the caller.
+func (db *DB) Rows() (*sql.Rows, error) {
+	if db.e == nil || db.e.Scope.Value == nil && !db.e.Search.Raw {
+		return nil, errors.New("missing model, before calling this startwith db.Model")
+	}
+	sql, ok := db.hooks.Query.Get(model.HookQuerySQL)
+	if !ok {
+		return nil, errors.New("missing query sql hook")
+	}
+	err := sql.Exec(db.hooks, db.e)
+	if err != nil {
+		return nil, err
+	}
+	if str, ok := db.e.Scope.Get(model.QueryOption); ok {
+		db.e.Scope.SQL += util.AddExtraSpaceIfExist(fmt.Sprint(str))
+	}
+	return db.SQLCommon().QueryContext(db.ctx, db.e.Scope.SQL, db.e.Scope.SQLVars...)
+}
+
+//ScanRows scans the current row of rows into value, which must be a pointer to
+//a struct.
+func (db *DB) ScanRows(rows *sql.Rows, value interface{}) error {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errmsg.ErrUnaddressable
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	fields, err := scope.Fields(db.NewEngine(), value)
+	if err != nil {
+		return err
+	}
+	return scope.Scan(rows, columns, fields)
+}
+
+//Each executes the query and calls fn with every resulting record, one row at
+//a time. fn must be a function of the form
+//
+//	func(*T) error
+//
+// where T is the model struct. Iteration stops at the first error returned by
+// fn and that error is returned. If no model was set by DB.Model then T is
+// used as the model.
+//
+//	err := db.Where("age > ?", 18).Each(func(u *User) error {
+//		return export(u)
+//	})
+func (db *DB) Each(fn interface{}) error {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumIn() != 1 || ft.NumOut() != 1 ||
+		ft.In(0).Kind() != reflect.Ptr || ft.In(0).Elem().Kind() != reflect.Struct ||
+		ft.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		return fmt.Errorf("Each expects func(*T) error got %s", ft)
+	}
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	if db.e.Scope.Value == nil {
+		db.e.Scope.Value = reflect.New(ft.In(0).Elem()).Interface()
+	}
+	rows, err := db.Rows()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		v := reflect.New(ft.In(0).Elem())
+		err = db.ScanRows(rows, v.Interface())
+		if err != nil {
+			return err
+		}
+		if out := fv.Call([]reflect.Value{v})[0]; !out.IsNil() {
+			return out.Interface().(error)
+		}
+	}
+	return rows.Err()
+}
+
+//FindInBatches finds the records matching the conditions in batches of size
+//records, out must be a pointer to a slice. For every batch out is set to the
+//records of the batch and fn is called with out and the number of the batch,
+//starting from 1. Iteration stops at the first error returned by fn and that
+//error is returned.
+//
+// The records are paged through by their primary key,
+//
+//	WHERE id > last ORDER BY id LIMIT size
+//
+// where last is the primary key of the last record of the previous batch, so
+// the cost of fetching a batch doesn't grow with the number of batches and
+// rows inserted or deleted while iterating are not skipped. Any order, limit
+// or offset set on db is ignored.
+//
+//	var users []User
+//	err := db.Where("active = ?", true).FindInBatches(&users, 1000,
+//		func(batch interface{}, n int) error {
+//			return export(*batch.(*[]User))
+//		})
+func (db *DB) FindInBatches(out interface{}, size int, fn func(batch interface{}, n int) error) error {
+	if size <= 0 {
+		return fmt.Errorf("invalid batch size %d", size)
+	}
+	results := reflect.ValueOf(out)
+	if results.Kind() != reflect.Ptr || results.Elem().Kind() != reflect.Slice {
+		return errors.New("results should be a pointer to a slice")
+	}
+	results = results.Elem()
+	elemType := results.Type().Elem()
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	e := db.NewEngine()
+	modelValue := reflect.New(elemType).Interface()
+	pf, err := scope.PrimaryField(e, modelValue)
+	if err != nil {
+		return err
+	}
+	if pf == nil {
+		return fmt.Errorf("%s has no primary key", elemType)
+	}
+	column := fmt.Sprintf("%v%v",
+		e.Dialect.QueryFieldName(scope.QuotedTableName(e, modelValue)), scope.Quote(e, pf.DBName))
+	q, ok := db.hooks.Query.Get(model.Query)
+	if !ok {
+		return errors.New("missing query hook")
+	}
+	base := *db.e.Search
+	var last interface{}
+	for n := 1; ; n++ {
+		s := base
+		s.WhereConditions = append([]*model.Clause{}, base.WhereConditions...)
+		if last != nil {
+			s.WhereConditions = append(s.WhereConditions, &model.Clause{
+				Query: fmt.Sprintf("%v > ?", column), Args: []interface{}{last}})
+		}
+		s.Orders = []interface{}{column}
+		s.Limit = size
+		s.Offset = nil
+		ne := db.NewEngine()
+		ne.Search = &s
+		ne.Scope.Value = out
+		err = q.Exec(db.hooks, ne)
+		if err != nil {
+			return err
+		}
+		count := results.Len()
+		if count == 0 {
+			return nil
+		}
+		lastRecord := reflect.Indirect(results.Index(count - 1))
+		lpf, err := scope.PrimaryField(ne, lastRecord.Addr().Interface())
+		if err != nil {
+			return err
+		}
+		last = lpf.Field.Interface()
+		err = fn(out, n)
+		if err != nil {
+			return err
+		}
+		if count < size {
+			return nil
+		}
+	}
+}
+
 // Attrs initialize struct with argument if record not found
 func (db *DB) Attrs(attrs ...interface{}) *DB {
 	if db.e == nil {
@@ -858,10 +1576,145 @@ func (db *DB) FirstOrInit(out interface{}, where ...interface{}) error {
 
 // Begin gives back a fresh copy of DB ready for chaining methods that operates
 // on the same model..
+//
+// Begin doesn't start a database transaction, use Tx or Transaction for that.
 func (db *DB) Begin() *DB {
 	return db.clone()
 }
 
+//WithContext returns a copy of db that uses ctx for all the queries it
+//executes, including the ones made by the dialect. The queries are aborted
+//when ctx is done.
+//
+//   ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+//   defer cancel()
+//   err := db.WithContext(ctx).Find(&users)
+func (db *DB) WithContext(ctx context.Context) *DB {
+	ndb := db.clone()
+	ndb.ctx = ctx
+	ndb.dialect = cloneDialect(db.dialect)
+	ndb.dialect.SetContext(ctx)
+	ndb.e = ndb.NewEngine()
+	return ndb
+}
+
+//Tx starts a new transaction and returns a copy of db that is bound to it. All
+//operations on the returned *DB and the copies derived from it are executed in
+//the transaction, which is ended by calling Commit or Rollback.
+//
+//If db is already bound to a transaction, a savepoint is created instead.
+//Commit then releases the savepoint and Rollback only rolls back the changes
+//made after the savepoint was created. errmsg.ErrSavePointUnsupported is
+//returned if the dialect doesn't support savepoints.
+//
+//   tx, err := db.Tx()
+//   if err != nil {
+//   	return err
+//   }
+//   err = tx.Create(&user)
+//   if err != nil {
+//   	_ = tx.Rollback()
+//   	return err
+//   }
+//   return tx.Commit()
+func (db *DB) Tx() (*DB, error) {
+	if tx, ok := db.db.(*model.SQLTx); ok {
+		name := tx.NextSavePoint()
+		query := db.dialect.SavePoint(name)
+		if query == "" {
+			return nil, errmsg.ErrSavePointUnsupported
+		}
+		_, err := tx.ExecContext(db.ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		ndb := db.clone()
+		ndb.savePoint = name
+		return ndb, nil
+	}
+	tx, err := db.db.BeginTx(db.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	ndb := db.clone()
+	ndb.db = &model.SQLTx{Tx: tx}
+	ndb.dialect = cloneDialect(db.dialect)
+	ndb.dialect.SetDB(ndb.db)
+	ndb.dialect.SetContext(ndb.ctx)
+	ndb.e = ndb.NewEngine()
+	return ndb, nil
+}
+
+// cloneDialect returns a shallow copy of d, so the copy can be bound to a
+// different SQLCommon without affecting d.
+func cloneDialect(d dialects.Dialect) dialects.Dialect {
+	v := reflect.ValueOf(d)
+	if v.Kind() != reflect.Ptr {
+		return d
+	}
+	n := reflect.New(v.Elem().Type())
+	n.Elem().Set(v.Elem())
+	return n.Interface().(dialects.Dialect)
+}
+
+//Commit commits the transaction that db is bound to, or releases the savepoint
+//if db was obtained by calling Tx on a transaction bound *DB. It returns
+//errmsg.ErrInvalidTransaction if db was not obtained by calling Tx.
+func (db *DB) Commit() error {
+	tx, ok := db.db.(*model.SQLTx)
+	if !ok {
+		return errmsg.ErrInvalidTransaction
+	}
+	if db.savePoint != "" {
+		query := db.dialect.ReleaseSavePoint(db.savePoint)
+		if query == "" {
+			return nil
+		}
+		_, err := tx.ExecContext(db.ctx, query)
+		return err
+	}
+	return tx.Commit()
+}
+
+//Rollback aborts the transaction that db is bound to, or rolls back to the
+//savepoint if db was obtained by calling Tx on a transaction bound *DB. It
+//returns errmsg.ErrInvalidTransaction if db was not obtained by calling Tx.
+func (db *DB) Rollback() error {
+	tx, ok := db.db.(*model.SQLTx)
+	if !ok {
+		return errmsg.ErrInvalidTransaction
+	}
+	if db.savePoint != "" {
+		_, err := tx.ExecContext(db.ctx, db.dialect.RollbackToSavePoint(db.savePoint))
+		return err
+	}
+	return tx.Rollback()
+}
+
+//Transaction executes fn inside a transaction. The transaction is committed
+//when fn returns nil, and rolled back when fn returns an error or panics.
+//
+//When db is already bound to a transaction, fn is executed inside a savepoint
+//so only the changes made by fn are rolled back, see Tx.
+func (db *DB) Transaction(fn func(tx *DB) error) error {
+	tx, err := db.Tx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // Table specify the table you would like to run db operations
 func (db *DB) Table(name string) *DB {
 	ndb := db.Begin()
@@ -885,7 +1738,7 @@ func (db *DB) Pluck(column string, value interface{}) error {
 	if err != nil {
 		return err
 	}
-	rows, err := db.SQLCommon().Query(db.e.Scope.SQL, db.e.Scope.SQLVars...)
+	rows, err := db.SQLCommon().QueryContext(db.ctx, db.e.Scope.SQL, db.e.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
@@ -898,13 +1751,13 @@ func (db *DB) Pluck(column string, value interface{}) error {
 		}
 		dest.Set(reflect.Append(dest, reflect.ValueOf(elem).Elem()))
 	}
-	return nil
+	return rows.Err()
 }
 
 // Count get how many records for a model
 func (db *DB) Count(value interface{}) error {
-	query, ok := db.e.Search.Selects["query"]
-	if !ok || regexes.CountingQuery.MatchString(fmt.Sprint(query)) {
+	if db.e.Search.Selects == nil ||
+		regexes.CountingQuery.MatchString(fmt.Sprint(db.e.Search.Selects.Query)) {
 		search.Select(db.e, "count(*)")
 	}
 	db.e.Search.IgnoreOrderQuery = true
@@ -912,7 +1765,7 @@ func (db *DB) Count(value interface{}) error {
 	if err != nil {
 		return err
 	}
-	return db.SQLCommon().QueryRow(db.e.Scope.SQL, db.e.Scope.SQLVars...).Scan(value)
+	return db.SQLCommon().QueryRowContext(db.ctx, db.e.Scope.SQL, db.e.Scope.SQLVars...).Scan(value)
 }
 
 // AddIndexSQL generates SQL to add index for columns with given name
@@ -933,7 +1786,7 @@ func (db *DB) AddIndex(indexName string, columns ...string) (sql.Result, error)
 	if err != nil {
 		return nil, err
 	}
-	return db.ExecTx(util.WrapTX(sql.Q), sql.Args...)
+	return db.ExecTx(dialects.WrapTX(db.dialect, sql.Q), sql.Args...)
 }
 
 // DropTableIfExists drop table if it is exist
@@ -1008,7 +1861,7 @@ func (db *DB) AddUniqueIndex(indexName string, columns ...string) (sql.Result, e
 	if err != nil {
 		return nil, err
 	}
-	return db.ExecTx(util.WrapTX(db.e.Scope.SQL), db.e.Scope.SQLVars...)
+	return db.ExecTx(dialects.WrapTX(db.dialect, db.e.Scope.SQL), db.e.Scope.SQLVars...)
 }
 
 // RemoveIndex remove index with name
@@ -1028,7 +1881,7 @@ func (db *DB) DropColumn(column string) (sql.Result, error) {
 	db.e.Scope.SQL = fmt.Sprintf("ALTER TABLE %v DROP COLUMN %v",
 		scope.QuotedTableName(db.e, db.e.Scope.Value), scope.Quote(db.e, column))
 	return db.ExecTx(
-		util.WrapTX(db.e.Scope.SQL), db.e.Scope.SQLVars...,
+		dialects.WrapTX(db.dialect, db.e.Scope.SQL), db.e.Scope.SQLVars...,
 	)
 }
 
@@ -1040,7 +1893,7 @@ func (db *DB) ModifyColumn(column string, typ string) (sql.Result, error) {
 	db.e.Scope.SQL = fmt.Sprintf("ALTER TABLE %v MODIFY %v %v",
 		scope.QuotedTableName(db.e, db.e.Scope.Value), scope.Quote(db.e, column), typ)
 	return db.ExecTx(
-		util.WrapTX(db.e.Scope.SQL), db.e.Scope.SQLVars...,
+		dialects.WrapTX(db.dialect, db.e.Scope.SQL), db.e.Scope.SQLVars...,
 	)
 }
 
@@ -1,12 +1,29 @@
 package ngorm
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	_ "github.com/cznic/ql/driver"
+	"github.com/gernest/ngorm/clause"
+	"github.com/gernest/ngorm/dialects"
+	"github.com/gernest/ngorm/dialects/ql"
+	"github.com/gernest/ngorm/dialects/sqlite"
+	"github.com/gernest/ngorm/engine"
+	"github.com/gernest/ngorm/errmsg"
 	"github.com/gernest/ngorm/fixture"
+	"github.com/gernest/ngorm/hooks"
+	"github.com/gernest/ngorm/model"
+	"github.com/gernest/ngorm/scope"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 type Foo struct {
@@ -599,7 +616,7 @@ func TestDB_AddIndexSQL(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	expect := `CREATE INDEX _idx_foo_stuff ON foos(stuff) `
+	expect := `CREATE INDEX _idx_foo_stuff ON foos(stuff)`
 	if sql.Q != expect {
 		t.Errorf("expected %s got %s", expect, sql.Q)
 	}
@@ -701,7 +718,7 @@ func TestDB_AddUniqueIndex(t *testing.T) {
 		t.Error("expected index to be created")
 	}
 	q := ndb.e.Scope.SQL
-	expect := `CREATE UNIQUE INDEX idx_foo_stuff ON foos(stuff) `
+	expect := `CREATE UNIQUE INDEX idx_foo_stuff ON foos(stuff)`
 	if q != expect {
 		t.Errorf("expected %s got %s", expect, q)
 	}
@@ -780,3 +797,2173 @@ func TestDB_FirstOrCreate(t *testing.T) {
 		t.Errorf("expected %d got %d", first.ID, second.ID)
 	}
 }
+
+type Owner struct {
+	ID        int64
+	Name      string
+	CompanyID int64
+	Company   Company
+	Emails    []Mail
+	Card      Card
+}
+
+type Company struct {
+	ID   int64
+	Name string
+}
+
+type Mail struct {
+	ID      int64
+	OwnerID int64
+	Email   string
+}
+
+type Card struct {
+	ID      int64
+	OwnerID int64
+	Number  string
+}
+
+func TestDB_Preload(t *testing.T) {
+	db, err := Open("ql-mem", "test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	_, err = db.Automigrate(&Owner{}, &Company{}, &Mail{}, &Card{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	company := Company{Name: "ngorm"}
+	err = db.Create(&company)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		o := Owner{Name: name, CompanyID: company.ID}
+		err = db.Create(&o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{"one", "two"} {
+			err = db.Create(&Mail{OwnerID: o.ID, Email: name + "@" + v})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = db.Create(&Card{OwnerID: o.ID, Number: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var owners []Owner
+	err = db.Begin().Preload("Emails").Preload("Company").
+		Preload("Card").Find(&owners)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 2 {
+		t.Fatalf("expected 2 owners got %d", len(owners))
+	}
+	for _, o := range owners {
+		if len(o.Emails) != 2 {
+			t.Errorf("expected 2 emails got %d", len(o.Emails))
+		}
+		for _, m := range o.Emails {
+			if !strings.HasPrefix(m.Email, o.Name+"@") {
+				t.Errorf("email %s doesn't belong to %s", m.Email, o.Name)
+			}
+		}
+		if o.Company.Name != company.Name {
+			t.Errorf("expected %s got %s", company.Name, o.Company.Name)
+		}
+		if o.Card.Number != o.Name {
+			t.Errorf("expected %s got %s", o.Name, o.Card.Number)
+		}
+	}
+
+	// With conditions
+	var owner Owner
+	err = db.Begin().Preload("Emails", "email = ?", "a@two").
+		Where("name = ?", "a").First(&owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owner.Emails) != 1 {
+		t.Fatalf("expected 1 email got %d", len(owner.Emails))
+	}
+	if owner.Emails[0].Email != "a@two" {
+		t.Errorf("expected a@two got %s", owner.Emails[0].Email)
+	}
+}
+
+type Shopper struct {
+	ID     int64
+	Name   string
+	Orders []Order
+	Tags   []Tag `gorm:"many2many:shopper_tags;"`
+}
+
+// Basket is created without the table of its eggs, so saving its eggs fails.
+type Basket struct {
+	ID   int64
+	Name string
+	Eggs []Egg
+}
+
+type Egg struct {
+	ID       int64
+	BasketID int64
+}
+
+type Order struct {
+	ID        int64
+	ShopperID int64
+	Items     []Item
+}
+
+type Item struct {
+	ID        int64
+	OrderID   int64
+	ProductID int64
+	Product   Product
+}
+
+type Product struct {
+	ID   int64
+	Name string
+}
+
+type Tag struct {
+	ID   int64
+	Name string
+}
+
+func TestDB_PreloadNested(t *testing.T) {
+	db, err := Open("ql-mem", "test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	_, err = db.Automigrate(&Shopper{}, &Order{}, &Item{}, &Product{}, &Tag{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags []Tag
+	for _, name := range []string{"new", "vip", "blocked"} {
+		tag := Tag{Name: name}
+		err = db.Create(&tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags = append(tags, tag)
+	}
+	for _, name := range []string{"a", "b"} {
+		s := Shopper{Name: name}
+		err = db.Create(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range tags[:2] {
+			_, err = db.ExecTx("INSERT INTO shopper_tags (shopper_id, tag_id) VALUES ($1, $2)", s.ID, tag.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		o := Order{ShopperID: s.ID}
+		err = db.Create(&o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{"one", "two"} {
+			p := Product{Name: name + v}
+			err = db.Create(&p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.Create(&Item{OrderID: o.ID, ProductID: p.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var shoppers []Shopper
+	err = db.Begin().Preload("Orders.Items.Product").
+		Preload("Tags", "name = ?", "vip").Find(&shoppers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shoppers) != 2 {
+		t.Fatalf("expected 2 shoppers got %d", len(shoppers))
+	}
+	for _, s := range shoppers {
+		if len(s.Tags) != 1 {
+			t.Fatalf("expected 1 tag got %d", len(s.Tags))
+		}
+		if s.Tags[0].Name != "vip" {
+			t.Errorf("expected vip got %s", s.Tags[0].Name)
+		}
+		if len(s.Orders) != 1 {
+			t.Fatalf("expected 1 order got %d", len(s.Orders))
+		}
+		items := s.Orders[0].Items
+		if len(items) != 2 {
+			t.Fatalf("expected 2 items got %d", len(items))
+		}
+		for _, i := range items {
+			if !strings.HasPrefix(i.Product.Name, s.Name) {
+				t.Errorf("product %s doesn't belong to %s", i.Product.Name, s.Name)
+			}
+		}
+	}
+}
+
+func TestDB_Transaction(t *testing.T) {
+	for _, d := range AllTestDB() {
+		runWrapDB(t, d, testDB_Transaction)
+	}
+}
+
+func testDB_Transaction(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Commit()
+	if err != errmsg.ErrInvalidTransaction {
+		t.Errorf("expected %v got %v", errmsg.ErrInvalidTransaction, err)
+	}
+	tx, err := db.Tx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Tx()
+	if err != errmsg.ErrSavePointUnsupported {
+		t.Errorf("expected %v got %v", errmsg.ErrSavePointUnsupported, err)
+	}
+	foo := Foo{Stuff: "commit"}
+	err = tx.Create(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Begin().Model(&foo).Update("stuff", "committed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Create(&Foo{Stuff: "delete"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Begin().Delete(&Foo{}, "stuff = ?", "delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := errors.New("rollback")
+	err = db.Transaction(func(tx *DB) error {
+		err := tx.Create(&Foo{Stuff: "rollback"})
+		if err != nil {
+			return err
+		}
+		err = tx.Begin().Model(&foo).Update("stuff", "rolled back")
+		if err != nil {
+			return err
+		}
+		return e
+	})
+	if err != e {
+		t.Fatalf("expected %v got %v", e, err)
+	}
+	var foos []Foo
+	err = db.Begin().Find(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(foos) != 1 {
+		t.Fatalf("expected 1 record got %d", len(foos))
+	}
+	if foos[0].Stuff != "committed" {
+		t.Errorf("expected committed got %s", foos[0].Stuff)
+	}
+
+	err = db.Transaction(func(tx *DB) error {
+		return tx.Create(&Foo{Stuff: "transaction"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	err = db.Begin().Model(&Foo{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 records got %d", count)
+	}
+}
+
+// savePointQL emulates savepoints with ql nested transactions.
+type savePointQL struct {
+	ql.QL
+}
+
+func (savePointQL) SavePoint(name string) string {
+	return "BEGIN TRANSACTION;"
+}
+
+func (savePointQL) RollbackToSavePoint(name string) string {
+	return "ROLLBACK;"
+}
+
+func (savePointQL) ReleaseSavePoint(name string) string {
+	return "COMMIT;"
+}
+
+type savePointOpener struct{}
+
+func (savePointOpener) Open(dialect string, args ...interface{}) (model.SQLCommon, dialects.Dialect, error) {
+	db, _, err := (&DefaultOpener{}).Open(dialect, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, &savePointQL{QL: *ql.Memory()}, nil
+}
+
+func TestDB_Transaction_nested(t *testing.T) {
+	db, err := OpenWithOpener(savePointOpener{}, "ql-mem", "nested.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	_, err = db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := errors.New("rollback")
+	err = db.Transaction(func(tx *DB) error {
+		err := tx.Create(&Foo{Stuff: "outer"})
+		if err != nil {
+			return err
+		}
+		err = tx.Transaction(func(tx *DB) error {
+			err := tx.Create(&Foo{Stuff: "failed"})
+			if err != nil {
+				return err
+			}
+			return e
+		})
+		if err != e {
+			t.Errorf("expected %v got %v", e, err)
+		}
+		return tx.Transaction(func(tx *DB) error {
+			return tx.Create(&Foo{Stuff: "inner"})
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var foos []Foo
+	err = db.Begin().Order("stuff").Find(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stuff []string
+	for _, f := range foos {
+		stuff = append(stuff, f.Stuff)
+	}
+	got := strings.Join(stuff, ",")
+	if got != "inner,outer" {
+		t.Errorf("expected inner,outer got %s", got)
+	}
+}
+
+func TestDB_WithContext(t *testing.T) {
+	for _, d := range AllTestDB() {
+		runWrapDB(t, d, testDB_WithContext)
+	}
+}
+
+func testDB_WithContext(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Foo{Stuff: "context"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cdb := db.WithContext(ctx)
+	var foos []Foo
+	err = cdb.Begin().Find(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(foos) != 1 {
+		t.Errorf("expected 1 record got %d", len(foos))
+	}
+	cancel()
+
+	err = cdb.Begin().Find(&foos)
+	if err != context.Canceled {
+		t.Errorf("expected %v got %v", context.Canceled, err)
+	}
+	err = cdb.Create(&Foo{Stuff: "canceled"})
+	if err != context.Canceled {
+		t.Errorf("expected %v got %v", context.Canceled, err)
+	}
+	var count int
+	err = cdb.Begin().Model(&Foo{}).Count(&count)
+	if err != context.Canceled {
+		t.Errorf("expected %v got %v", context.Canceled, err)
+	}
+	var stuff []string
+	err = cdb.Begin().Model(&Foo{}).Pluck("stuff", &stuff)
+	if err != context.Canceled {
+		t.Errorf("expected %v got %v", context.Canceled, err)
+	}
+	if cdb.HasTable(&Foo{}) {
+		t.Error("expected HasTable to fail with a canceled context")
+	}
+	if !db.HasTable(&Foo{}) {
+		t.Error("expected the parent db to be unaffected")
+	}
+}
+
+func TestDB_SQLite(t *testing.T) {
+	runWrapDB(t, &wrapSQLite{}, testDB_SQLite)
+}
+
+func testDB_SQLite(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{}, &Shopper{}, &Tag{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.HasTable("shopper_tags") {
+		t.Error("expected the join table to be created")
+	}
+	foo := Foo{Stuff: "sqlite"}
+	err = db.Create(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.ID == 0 {
+		t.Fatal("expected the primary key to be set")
+	}
+	err = db.Begin().Model(&foo).Update("stuff", "updated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first Foo
+	err = db.Begin().First(&first, foo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Stuff != "updated" {
+		t.Errorf("expected updated got %s", first.Stuff)
+	}
+
+	e := errors.New("rollback")
+	err = db.Transaction(func(tx *DB) error {
+		err := tx.Create(&Foo{Stuff: "outer"})
+		if err != nil {
+			return err
+		}
+		err = tx.Transaction(func(tx *DB) error {
+			err := tx.Begin().Model(&foo).Update("stuff", "inner")
+			if err != nil {
+				return err
+			}
+			return e
+		})
+		if err != e {
+			t.Errorf("expected %v got %v", e, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var foos []Foo
+	err = db.Begin().Order("id").Find(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(foos) != 2 {
+		t.Fatalf("expected 2 records got %d", len(foos))
+	}
+	if foos[0].Stuff != "updated" || foos[1].Stuff != "outer" {
+		t.Errorf("expected updated, outer got %s, %s", foos[0].Stuff, foos[1].Stuff)
+	}
+
+	err = db.Begin().Delete(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	err = db.Begin().Model(&Foo{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 record got %d", count)
+	}
+
+	s := Shopper{Name: "sqlite"}
+	err = db.Create(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := Tag{Name: "tag"}
+	err = db.Create(&tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.ExecTx(`INSERT INTO "shopper_tags" ("shopper_id", "tag_id") VALUES (?, ?)`, s.ID, tag.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shoppers []Shopper
+	err = db.Begin().Preload("Tags").Find(&shoppers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shoppers) != 1 || len(shoppers[0].Tags) != 1 {
+		t.Fatalf("expected 1 shopper with 1 tag got %v", shoppers)
+	}
+}
+
+func TestDB_Postgres(t *testing.T) {
+	rec, sqlDB := fixture.NewRecorder()
+	db, err := Open("postgres", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	sql, err := db.CreateTableSQL(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `CREATE TABLE "foos" ("id" serial,"stuff" varchar(255) , PRIMARY KEY ("id"))`
+	if q := strings.TrimSpace(sql.Q); q != expect+" ;" {
+		t.Errorf("expected %s got %s", expect, q)
+	}
+
+	rec.Reply("INSERT INTO", []string{"id"}, []interface{}{int64(7)})
+	foo := Foo{Stuff: "postgres"}
+	err = db.Create(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.ID != 7 {
+		t.Errorf("expected 7 got %d", foo.ID)
+	}
+	expect = `INSERT INTO "foos" ("stuff") VALUES ($1) RETURNING "id"`
+	if q := rec.Last(); q.SQL != expect {
+		t.Errorf("expected %s got %s", expect, q.SQL)
+	}
+
+	rec.Reset()
+	err = db.Transaction(func(tx *DB) error {
+		err := tx.Begin().Model(&foo).Update("stuff", "updated")
+		if err != nil {
+			return err
+		}
+		_ = tx.Transaction(func(tx *DB) error {
+			return errors.New("rollback")
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries []string
+	for _, q := range rec.Queries() {
+		queries = append(queries, q.SQL)
+	}
+	expectQueries := []string{
+		"BEGIN",
+		`UPDATE "foos" SET "stuff" = $1  WHERE "foos"."id" = $2`,
+		`SAVEPOINT "ngorm_savepoint_1"`,
+		`ROLLBACK TO SAVEPOINT "ngorm_savepoint_1"`,
+		"COMMIT",
+	}
+	got := strings.Join(queries, "\n")
+	if got != strings.Join(expectQueries, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expectQueries, "\n"), got)
+	}
+}
+
+func TestDB_MySQL(t *testing.T) {
+	rec, sqlDB := fixture.NewRecorder()
+	db, err := Open("mysql", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	sql, err := db.CreateTableSQL(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "CREATE TABLE `foos` (`id` int AUTO_INCREMENT,`stuff` varchar(255) , PRIMARY KEY (`id`)) ;"
+	if q := strings.TrimSpace(sql.Q); q != expect {
+		t.Errorf("expected %s got %s", expect, q)
+	}
+	rec.LastInsertID = 3
+	foo := Foo{Stuff: "mysql"}
+	err = db.Create(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.ID != 3 {
+		t.Errorf("expected 3 got %d", foo.ID)
+	}
+	expect = "INSERT INTO `foos` (`stuff`) VALUES (?)"
+	if q := rec.Queries(); q[len(q)-2].SQL != expect {
+		t.Errorf("expected %s got %s", expect, q[len(q)-2].SQL)
+	}
+}
+
+func TestDB_MSSQL(t *testing.T) {
+	rec, sqlDB := fixture.NewRecorder()
+	db, err := Open("mssql", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	sql, err := db.CreateTableSQL(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "CREATE TABLE [foos] ([id] int IDENTITY(1,1),[stuff] nvarchar(255) , PRIMARY KEY ([id])) ;"
+	if q := strings.TrimSpace(sql.Q); q != expect {
+		t.Errorf("expected %s got %s", expect, q)
+	}
+
+	rec.Reply("INSERT INTO", []string{"id"}, []interface{}{int64(5)})
+	foo := Foo{Stuff: "mssql"}
+	err = db.Create(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.ID != 5 {
+		t.Errorf("expected 5 got %d", foo.ID)
+	}
+	expect = "INSERT INTO [foos] ([stuff]) OUTPUT INSERTED.[id] VALUES (@p1)"
+	if q := rec.Last(); q.SQL != expect {
+		t.Errorf("expected %s got %s", expect, q.SQL)
+	}
+
+	s, err := db.Begin().Limit(2).Offset(4).FindSQL(&[]Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "SELECT * FROM [foos]   ORDER BY [foos].[id] OFFSET 4 ROWS FETCH NEXT 2 ROWS ONLY"
+	if s.Q != expect {
+		t.Errorf("expected %s got %s", expect, s.Q)
+	}
+	s, err = db.Begin().Order("stuff").Limit(2).FindSQL(&[]Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "SELECT * FROM [foos]   ORDER BY [stuff] OFFSET 0 ROWS FETCH NEXT 2 ROWS ONLY"
+	if s.Q != expect {
+		t.Errorf("expected %s got %s", expect, s.Q)
+	}
+
+	sub, err := db.Begin().Model(&Foo{}).Select("id").Where("stuff = ?", "a").Limit(2).SubQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = db.Begin().Where("id IN (?)", sub).Where("stuff != ?", "b").FindSQL(&[]Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "SELECT * FROM [foos]  WHERE (id IN (SELECT id FROM [foos]  WHERE (stuff = @p1) ORDER BY [foos].[id] OFFSET 0 ROWS FETCH NEXT 2 ROWS ONLY)) AND (stuff != @p2)"
+	if s.Q != expect {
+		t.Errorf("expected %s got %s", expect, s.Q)
+	}
+}
+
+type registeredQL struct {
+	ql.QL
+}
+
+func (registeredQL) GetName() string {
+	return "registered-ql"
+}
+
+var registeredCreated int
+
+func init() {
+	dialects.Register("registered-ql", func() dialects.Dialect {
+		return &registeredQL{QL: *ql.Memory()}
+	})
+	hooks.RegisterDialect("registered-ql", func(b *hooks.Book) {
+		b.Create.Set(hooks.HookFunc(model.AfterCreate, func(b *hooks.Book, e *engine.Engine) error {
+			registeredCreated++
+			return hooks.QLAfterCreate(b, e)
+		}))
+	})
+}
+
+func TestOpen_registeredDialect(t *testing.T) {
+	registeredCreated = 0
+	db, err := Open("registered-ql", "ql-mem", "registered.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	if _, ok := db.Dialect().(*registeredQL); !ok {
+		t.Errorf("expected *registeredQL got %T", db.Dialect())
+	}
+	_, err = db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Foo{Stuff: "registered"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registeredCreated != 1 {
+		t.Errorf("expected the AfterCreate override to run once got %d", registeredCreated)
+	}
+	_, err = Open("unknown-dialect", "ql-mem", "unknown.db")
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDB_Association(t *testing.T) {
+	for _, d := range AllTestDBWithSQLite() {
+		runWrapDB(t, d, testDB_Association)
+	}
+}
+
+func testDB_Association(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shopper{}, &Order{}, &Item{}, &Product{}, &Tag{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shopper := Shopper{Name: "association"}
+	err = db.Create(&shopper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := func(a *Association, expect int) {
+		t.Helper()
+		n, err := a.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != expect {
+			t.Errorf("expected %d got %d", expect, n)
+		}
+	}
+
+	// has_many
+	orders := db.Model(&shopper).Association("Orders")
+	first, second := &Order{}, &Order{}
+	err = orders.Append(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == 0 || first.ShopperID != shopper.ID {
+		t.Errorf("expected the order to be saved with the shopper id got %#v", first)
+	}
+	if len(shopper.Orders) != 2 {
+		t.Errorf("expected 2 orders got %d", len(shopper.Orders))
+	}
+	count(orders, 2)
+	var found []Order
+	err = orders.Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Errorf("expected 2 orders got %d", len(found))
+	}
+	err = orders.Delete(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count(orders, 1)
+	if len(shopper.Orders) != 1 || shopper.Orders[0].ID != second.ID {
+		t.Errorf("expected the second order to be kept got %#v", shopper.Orders)
+	}
+	third := &Order{}
+	err = orders.Replace(third)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count(orders, 1)
+	found = nil
+	err = orders.Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != third.ID {
+		t.Errorf("expected the third order got %#v", found)
+	}
+	err = orders.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count(orders, 0)
+	if len(shopper.Orders) != 0 {
+		t.Errorf("expected no orders got %d", len(shopper.Orders))
+	}
+
+	// many_to_many
+	tags := db.Model(&shopper).Association("Tags")
+	vip, fresh := &Tag{Name: "vip"}, &Tag{Name: "new"}
+	err = tags.Append(vip, fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tags.Append(vip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count(tags, 2)
+	err = tags.Delete(fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count(tags, 1)
+	var foundTags []Tag
+	err = tags.Find(&foundTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(foundTags) != 1 || foundTags[0].Name != "vip" {
+		t.Errorf("expected the vip tag got %#v", foundTags)
+	}
+	err = tags.Replace(fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foundTags = nil
+	err = tags.Find(&foundTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(foundTags) != 1 || foundTags[0].Name != "new" {
+		t.Errorf("expected the new tag got %#v", foundTags)
+	}
+	err = tags.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count(tags, 0)
+
+	// belongs_to
+	item := Item{}
+	err = db.Create(&item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	product := db.Model(&item).Association("Product")
+	count(product, 0)
+	err = product.Append(&Product{Name: "belongs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ProductID == 0 || item.Product.Name != "belongs" {
+		t.Errorf("expected the product to be set got %#v", item)
+	}
+	var p Product
+	err = product.Find(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "belongs" {
+		t.Errorf("expected belongs got %s", p.Name)
+	}
+	err = product.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ProductID != 0 {
+		t.Errorf("expected the product id to be cleared got %d", item.ProductID)
+	}
+	count(product, 0)
+
+	if err = db.Model(&shopper).Association("Name").Append(&Tag{}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDB_SaveAfterAssociation(t *testing.T) {
+	for _, d := range AllTestDBWithSQLite() {
+		runWrapDB(t, d, testDB_SaveAfterAssociation)
+	}
+}
+
+func testDB_SaveAfterAssociation(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shopper{}, &Order{}, &Item{}, &Product{}, &Tag{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shopper := Shopper{
+		Name: "nested",
+		Orders: []Order{
+			{Items: []Item{
+				{Product: Product{Name: "one"}},
+				{Product: Product{Name: "two"}},
+			}},
+		},
+		Tags: []Tag{{Name: "new"}, {Name: "vip"}},
+	}
+	err = db.Create(&shopper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := shopper.Orders[0]
+	if order.ID == 0 {
+		t.Fatal("expected the order to be created")
+	}
+	if order.ShopperID != shopper.ID {
+		t.Errorf("expected shopper id %d got %d", shopper.ID, order.ShopperID)
+	}
+	for _, i := range order.Items {
+		if i.OrderID != order.ID {
+			t.Errorf("expected order id %d got %d", order.ID, i.OrderID)
+		}
+		if i.ProductID == 0 || i.ProductID != i.Product.ID {
+			t.Errorf("expected product id %d got %d", i.Product.ID, i.ProductID)
+		}
+	}
+
+	// Saving again updates the existing records and adds the new ones without
+	// duplicating the join table rows.
+	shopper.Orders = append(shopper.Orders, Order{})
+	shopper.Tags = append(shopper.Tags, Tag{Name: "blocked"})
+	err = db.Save(&shopper)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found Shopper
+	err = db.Begin().Preload("Orders.Items.Product").Preload("Tags").
+		Where("name = ?", "nested").First(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found.Orders) != 2 {
+		t.Fatalf("expected 2 orders got %d", len(found.Orders))
+	}
+	var items int
+	for _, o := range found.Orders {
+		items += len(o.Items)
+	}
+	if items != 2 {
+		t.Errorf("expected 2 items got %d", items)
+	}
+	if len(found.Tags) != 3 {
+		t.Errorf("expected 3 tags got %d", len(found.Tags))
+	}
+	var links int
+	err = db.SQLCommon().QueryRow("SELECT count(*) FROM shopper_tags").Scan(&links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if links != 3 {
+		t.Errorf("expected 3 join rows got %d", links)
+	}
+
+	// The record is not created when saving its associations fails.
+	_, err = db.Automigrate(&Basket{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Basket{Name: "broken", Eggs: []Egg{{}}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	var baskets int
+	err = db.SQLCommon().QueryRow("SELECT count(*) FROM baskets").Scan(&baskets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baskets != 0 {
+		t.Errorf("expected the basket to be rolled back got %d", baskets)
+	}
+}
+
+func TestDB_Polymorphic(t *testing.T) {
+	for _, d := range AllTestDBWithSQLite() {
+		runWrapDB(t, d, testDB_Polymorphic)
+	}
+}
+
+func testDB_Polymorphic(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&fixture.Cat{}, &fixture.Dog{}, &fixture.Hamster{}, &fixture.Toy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cat := fixture.Cat{Name: "kitty", Toy: fixture.Toy{Name: "ball"}}
+	dog := fixture.Dog{Name: "rex", Toys: []fixture.Toy{{Name: "bone"}, {Name: "stick"}}}
+	hamster := fixture.Hamster{Name: "ham",
+		PreferredToy: fixture.Toy{Name: "wheel"},
+		OtherToy:     fixture.Toy{Name: "tube"},
+	}
+	for _, v := range []interface{}{&cat, &dog, &hamster} {
+		err = db.Create(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var toys []fixture.Toy
+	err = db.Begin().Find(&toys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]string{
+		"ball":  "cats",
+		"bone":  "dogs",
+		"stick": "dogs",
+		"wheel": "hamster_preferred",
+		"tube":  "hamster_other",
+	}
+	if len(toys) != len(types) {
+		t.Fatalf("expected %d toys got %d", len(types), len(toys))
+	}
+	for _, toy := range toys {
+		if toy.OwnerType != types[toy.Name] {
+			t.Errorf("expected %s owner type for %s got %s", types[toy.Name], toy.Name, toy.OwnerType)
+		}
+	}
+
+	var dogs []fixture.Dog
+	err = db.Begin().Preload("Toys").Find(&dogs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dogs) != 1 || len(dogs[0].Toys) != 2 {
+		t.Fatalf("expected 2 dog toys got %v", dogs)
+	}
+	var hamsters []fixture.Hamster
+	err = db.Begin().Preload("PreferredToy").Preload("OtherToy").Find(&hamsters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hamsters) != 1 {
+		t.Fatalf("expected 1 hamster got %d", len(hamsters))
+	}
+	if hamsters[0].PreferredToy.Name != "wheel" {
+		t.Errorf("expected wheel got %s", hamsters[0].PreferredToy.Name)
+	}
+	if hamsters[0].OtherToy.Name != "tube" {
+		t.Errorf("expected tube got %s", hamsters[0].OtherToy.Name)
+	}
+
+	a := db.Model(&dog).Association("Toys")
+	err = a.Append(&fixture.Toy{Name: "rope"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 dog toys got %d", n)
+	}
+	err = a.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = db.Model(&cat).Association("Toy").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 cat toy got %d", n)
+	}
+}
+
+func TestDB_Rows(t *testing.T) {
+	for _, d := range AllTestDB() {
+		runWrapDB(t, d, testDB_Rows)
+	}
+}
+
+func testDB_Rows(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Product{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		err = db.Create(&Product{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := db.Begin().Model(&Product{}).Where("name > ?", "a").Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for rows.Next() {
+		var p Product
+		err = db.ScanRows(rows, &p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ID == 0 {
+			t.Errorf("expected the id of %s to be scanned", p.Name)
+		}
+		names = append(names, p.Name)
+	}
+	_ = rows.Close()
+	sort.Strings(names)
+	if strings.Join(names, ",") != "b,c,d" {
+		t.Errorf("expected b,c,d got %v", names)
+	}
+
+	names = nil
+	err = db.Begin().Where("name < ?", "d").Each(func(p *Product) error {
+		names = append(names, p.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "a,b,c" {
+		t.Errorf("expected a,b,c got %v", names)
+	}
+
+	stop := errors.New("stop")
+	var n int
+	err = db.Begin().Each(func(p *Product) error {
+		n++
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected %v got %v", stop, err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 call got %d", n)
+	}
+	err = db.Begin().Each(func(p Product) {})
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	// name can not be scanned into the integer id.
+	err = db.Begin().Model(&Product{}).Select("name AS id").Each(func(p *Product) error {
+		return nil
+	})
+	if err == nil {
+		t.Error("expected the scan error")
+	}
+}
+
+func TestDB_FindInBatches(t *testing.T) {
+	for _, d := range AllTestDB() {
+		runWrapDB(t, d, testDB_FindInBatches)
+	}
+}
+
+func testDB_FindInBatches(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Product{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		err = db.Create(&Product{Name: fmt.Sprintf("product-%d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.Create(&Product{Name: "skip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var products []Product
+	var sizes []int
+	var last int64
+	err = db.Begin().Where("name != ?", "skip").FindInBatches(&products, 3,
+		func(batch interface{}, n int) error {
+			b := *batch.(*[]Product)
+			if n != len(sizes)+1 {
+				t.Errorf("expected batch %d got %d", len(sizes)+1, n)
+			}
+			for _, p := range b {
+				if p.ID <= last {
+					t.Errorf("expected ids greater than %d got %d", last, p.ID)
+				}
+				last = p.ID
+			}
+			sizes = append(sizes, len(b))
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(sizes) != "[3 3 1]" {
+		t.Errorf("expected batches of [3 3 1] got %v", sizes)
+	}
+
+	stop := errors.New("stop")
+	var calls int
+	err = db.Begin().FindInBatches(&products, 2, func(batch interface{}, n int) error {
+		calls++
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected %v got %v", stop, err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call got %d", calls)
+	}
+	err = db.Begin().FindInBatches(&products, 0, func(batch interface{}, n int) error {
+		return nil
+	})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDB_Raw(t *testing.T) {
+	for _, d := range AllTestDBWithSQLite() {
+		runWrapDB(t, d, testDB_Raw)
+	}
+}
+
+func testDB_Raw(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Product{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		_, err = db.Exec("INSERT INTO products (name) VALUES (@name)",
+			struct{ Name string }{name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.Exec("UPDATE products SET name = ? WHERE name = ?", "d", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		Name string
+	}
+	var results []result
+	err = db.Begin().Raw("SELECT name FROM products WHERE name != @name ORDER BY name",
+		map[string]interface{}{"name": "a"}).Scan(&results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(results) != "[{b} {d}]" {
+		t.Errorf("expected [{b} {d}] got %v", results)
+	}
+
+	var r result
+	err = db.Begin().Raw("SELECT name FROM products WHERE name = ?", "b").Scan(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "b" {
+		t.Errorf("expected b got %s", r.Name)
+	}
+
+	var rows []map[string]interface{}
+	err = db.Begin().Raw("SELECT name FROM products WHERE name IN (?)",
+		[]string{"a", "d"}).Scan(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows got %d", len(rows))
+	}
+	for _, row := range rows {
+		name := fmt.Sprintf("%s", row["name"])
+		if name != "a" && name != "d" {
+			t.Errorf("unexpected name %v", row["name"])
+		}
+	}
+
+	var count int
+	err = db.Begin().Raw("SELECT count(*) FROM products").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 got %d", count)
+	}
+}
+
+func TestDB_SubQuery(t *testing.T) {
+	for _, d := range AllTestDBWithSQLite() {
+		runWrapDB(t, d, testDB_SubQuery)
+	}
+}
+
+func testDB_SubQuery(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shopper{}, &Order{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		s := Shopper{Name: name}
+		err = db.Create(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < i; j++ {
+			err = db.Create(&Order{ShopperID: s.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var min Shopper
+	err = db.Begin().Where("name = ?", "b").First(&min)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := db.Begin().Model(&Order{}).Select("shopper_id").
+		Where("shopper_id >= ?", min.ID).SubQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shoppers []Shopper
+	err = db.Begin().Where("name != ?", "x").Where("id IN (?)", sub).
+		Order("name").Find(&shoppers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range shoppers {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "b,c" {
+		t.Errorf("expected b,c got %v", names)
+	}
+}
+
+type Subscriber struct {
+	ID    int64
+	Email string
+	Name  string
+	Plan  string
+}
+
+func TestDB_Upsert(t *testing.T) {
+	for _, d := range AllTestDBWithSQLite() {
+		runWrapDB(t, d, testDB_Upsert)
+	}
+}
+
+func testDB_Upsert(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Subscriber{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Model(&Subscriber{}).AddUniqueIndex("uix_subscribers_email", "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	onEmail := clause.OnConflict{
+		Columns:   []string{"email"},
+		DoUpdates: []string{"name"},
+	}
+	first := Subscriber{Email: "a@example.com", Name: "a", Plan: "free"}
+	err = db.Begin().Clauses(onEmail).Create(&first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == 0 {
+		t.Fatal("expected the primary key to be set")
+	}
+	second := Subscriber{Email: "a@example.com", Name: "b", Plan: "pro"}
+	err = db.Begin().Clauses(onEmail).Create(&second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("expected %d got %d", first.ID, second.ID)
+	}
+	third := Subscriber{Email: "a@example.com", Name: "c", Plan: "pro"}
+	err = db.Begin().Clauses(clause.OnConflict{Columns: []string{"email"}}).Create(&third)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ID != first.ID {
+		t.Errorf("expected %d got %d", first.ID, third.ID)
+	}
+	var count int64
+	err = db.Begin().Model(&Subscriber{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 subscriber got %d", count)
+	}
+	var s Subscriber
+	err = db.Begin().First(&s, first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "b" || s.Plan != "free" {
+		t.Errorf("expected name b and plan free got %s and %s", s.Name, s.Plan)
+	}
+
+	// The conflict columns default to the primary key, a new record is
+	// inserted.
+	onID := clause.OnConflict{DoUpdates: []string{"name"}}
+	fourth := Subscriber{Email: "d@example.com", Name: "d"}
+	err = db.Begin().Clauses(onID).Create(&fourth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fourth.ID == 0 || fourth.ID == first.ID {
+		t.Fatalf("expected a new primary key got %d", fourth.ID)
+	}
+	fifth := Subscriber{ID: fourth.ID, Email: "d@example.com", Name: "e"}
+	err = db.Begin().Clauses(onID).Create(&fifth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = Subscriber{}
+	err = db.Begin().First(&s, fourth.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "e" {
+		t.Errorf("expected name e got %s", s.Name)
+	}
+
+	// The option is not left on the db the clauses were set on.
+	err = db.Clauses(onEmail).Create(&Subscriber{Email: "f@example.com", Name: "f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Subscriber{Email: "f@example.com", Name: "g"})
+	if err == nil {
+		t.Error("expected the plain insert to violate the unique index")
+	}
+	s = Subscriber{}
+	err = db.Begin().Where("email = ?", "f@example.com").First(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "f" {
+		t.Errorf("expected name f got %s", s.Name)
+	}
+}
+
+func TestDB_CreateBatch(t *testing.T) {
+	for _, d := range AllTestDBWithSQLite() {
+		runWrapDB(t, d, testDB_CreateBatch)
+	}
+}
+
+func testDB_CreateBatch(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shopper{}, &Order{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before, after int
+	db.Hooks().Create.Set(hooks.HookFunc(model.BeforeCreate, func(b *hooks.Book, e *engine.Engine) error {
+		before++
+		return nil
+	}))
+	ac, ok := db.Hooks().Create.Get(model.AfterCreate)
+	db.Hooks().Create.Set(hooks.HookFunc(model.AfterCreate, func(b *hooks.Book, e *engine.Engine) error {
+		after++
+		if ok {
+			return ac.Exec(b, e)
+		}
+		return nil
+	}))
+	var shoppers []Shopper
+	for i := 0; i < 25; i++ {
+		s := Shopper{Name: fmt.Sprintf("shopper %02d", i)}
+		if i%10 == 0 {
+			s.Orders = []Order{{}}
+		}
+		shoppers = append(shoppers, s)
+	}
+	err = db.CreateInBatches(&shoppers, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the orders are created with the hooks of their shoppers.
+	if before != 28 || after != 28 {
+		t.Errorf("expected the hooks to run 28 times got %d and %d", before, after)
+	}
+	var saved []Shopper
+	err = db.Begin().Order("name").Find(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != len(shoppers) {
+		t.Fatalf("expected %d shoppers got %d", len(shoppers), len(saved))
+	}
+	for i := range saved {
+		if shoppers[i].ID != saved[i].ID || shoppers[i].Name != saved[i].Name {
+			t.Errorf("expected %d %s got %d %s", saved[i].ID, saved[i].Name,
+				shoppers[i].ID, shoppers[i].Name)
+		}
+	}
+	var count int64
+	err = db.Begin().Model(&Order{}).Where("shopper_id = ?", shoppers[10].ID).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 order got %d", count)
+	}
+
+	products := []*Product{{Name: "a"}, {Name: "b"}}
+	_, err = db.Automigrate(&Product{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if products[0].ID == 0 || products[0].ID == products[1].ID {
+		t.Errorf("expected distinct primary keys got %d and %d", products[0].ID, products[1].ID)
+	}
+}
+
+type noteV1 struct {
+	ID    int64
+	Title string
+	Body  string `sql:"index"`
+	Count int64
+	Stale string
+}
+
+func (noteV1) TableName() string {
+	return "notes"
+}
+
+type noteV2 struct {
+	ID    int64
+	Title string
+	Body  string
+	Count string
+	Rank  int64 `sql:"index"`
+}
+
+func (noteV2) TableName() string {
+	return "notes"
+}
+
+func TestDB_AutomigrateDiff(t *testing.T) {
+	for _, d := range AllTestDBWithSQLite() {
+		runWrapDB(t, d, testDB_AutomigrateDiff)
+	}
+}
+
+func testDB_AutomigrateDiff(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&noteV1{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Model(&noteV1{}).AddIndex("notes_by_title", "title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := db.NewEngine()
+	err = scope.Automigrate(e, &noteV2{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := func(s []*model.MigrationStep) []string {
+		var o []string
+		for _, step := range s {
+			o = append(o, fmt.Sprintf("%s %s", step.Action, step.Name))
+		}
+		return o
+	}
+	plan := e.Scope.Migration
+	safe := fmt.Sprint(steps(plan.Safe))
+	expect := "[add_column rank add_index idx_notes_rank]"
+	if safe != expect {
+		t.Errorf("expected %s got %s", expect, safe)
+	}
+	destructive := fmt.Sprint(steps(plan.Destructive))
+	expect = "[alter_column count drop_column stale drop_index idx_notes_body]"
+	if destructive != expect {
+		t.Errorf("expected %s got %s", expect, destructive)
+	}
+
+	_, err = db.Automigrate(&noteV2{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Dialect().HasColumn("notes", "rank") || !db.Dialect().HasIndex("notes", "idx_notes_rank") {
+		t.Error("expected the safe steps to be applied")
+	}
+	if !db.Dialect().HasColumn("notes", "stale") || !db.Dialect().HasIndex("notes", "idx_notes_body") {
+		t.Error("expected the destructive steps to be skipped")
+	}
+	_, err = db.Begin().Set(model.AutomigrateDestructive, true).Automigrate(&noteV2{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Dialect().HasColumn("notes", "stale") || db.Dialect().HasIndex("notes", "idx_notes_body") {
+		t.Error("expected the destructive steps to be applied")
+	}
+	if !db.Dialect().HasIndex("notes", "notes_by_title") {
+		t.Error("expected the index added by hand to be kept")
+	}
+	e = db.NewEngine()
+	err = scope.Automigrate(e, &noteV2{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(e.Scope.Migration.Safe); n != 0 {
+		t.Errorf("expected no safe steps got %d", n)
+	}
+}
+
+func TestDB_MigrationPlan(t *testing.T) {
+	for _, d := range AllTestDB() {
+		runWrapDB(t, d, testDB_MigrationPlan)
+	}
+}
+
+func testDB_MigrationPlan(t *testing.T, db *DB) {
+	plan, err := db.MigrationPlan(&fixture.User{}, &fixture.Language{}, &noteV1{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps []string
+	for _, step := range plan.Safe {
+		steps = append(steps, fmt.Sprintf("%s %s %s", step.Action, step.Table, step.Name))
+	}
+	expect := "[create_table users  create_join_table user_languages  " +
+		"create_table languages  add_index languages idx_languages_deleted_at " +
+		"create_table notes  add_index notes idx_notes_body]"
+	if s := fmt.Sprint(steps); s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	if len(plan.Destructive) != 0 {
+		t.Errorf("expected no destructive steps got %v", plan.Destructive)
+	}
+	text := plan.String()
+	for _, step := range plan.Safe {
+		if !strings.Contains(text, step.SQL+";") {
+			t.Errorf("expected %s in %s", step.SQL, text)
+		}
+	}
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded model.MigrationPlan
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Safe) != len(plan.Safe) || decoded.Safe[0].SQL != plan.Safe[0].SQL ||
+		decoded.Safe[0].Action != model.CreateTable {
+		t.Errorf("expected the plan to survive JSON got %s", data)
+	}
+
+	_, err = db.Automigrate(&noteV1{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err = db.MigrationPlan(&noteV2{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, err := db.AutomigrateSQL(&noteV2{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range plan.Safe {
+		if !strings.Contains(sql.Q, step.SQL+";") {
+			t.Errorf("expected %s in %s", step.SQL, sql.Q)
+		}
+	}
+	for _, step := range plan.Destructive {
+		if step.SQL != "" && strings.Contains(sql.Q, step.SQL+";") {
+			t.Errorf("expected no %s in %s", step.SQL, sql.Q)
+		}
+	}
+}
+
+type Author struct {
+	ID     int64
+	Name   string
+	Labels []Label `gorm:"many2many:author_labels;CONSTRAINT:OnDelete:CASCADE"`
+}
+
+type Label struct {
+	ID   int64
+	Name string
+}
+
+type Post struct {
+	ID       int64
+	Title    string
+	Author   Author `gorm:"CONSTRAINT:OnDelete:CASCADE"`
+	AuthorID int64
+}
+
+type Draft struct {
+	ID       int64
+	Author   Author `gorm:"CONSTRAINT:OnDelete:EXPLODE"`
+	AuthorID int64
+}
+
+type Publisher struct {
+	ID    int64
+	Name  string
+	Books []Book `gorm:"CONSTRAINT:OnDelete:CASCADE"`
+}
+
+type Book struct {
+	ID          int64
+	Title       string
+	PublisherID int64
+}
+
+func TestDB_ForeignKeys(t *testing.T) {
+	runWrapDB(t, &wrapSQLite{params: "?_foreign_keys=1"}, testDB_ForeignKeys)
+}
+
+func testDB_ForeignKeys(t *testing.T, db *DB) {
+	_, err := db.MigrationPlan(&Draft{})
+	if err == nil {
+		t.Error("expected an error for an unknown referential action")
+	}
+	sql, err := db.CreateTableSQL(&Post{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `REFERENCES "authors"("id") ON DELETE CASCADE`
+	if !strings.Contains(sql.Q, expect) {
+		t.Errorf("expected %s in %s", expect, sql.Q)
+	}
+	_, err = db.Automigrate(&Post{}, &Author{}, &Label{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	label := &Label{Name: "go"}
+	err = db.Create(label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	author := &Author{Name: "gernest", Labels: []Label{*label}}
+	err = db.Create(author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Post{Title: "ngorm", AuthorID: author.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Post{Title: "orphan", AuthorID: author.ID + 1})
+	if err == nil {
+		t.Error("expected the constraint to reject a missing author")
+	}
+	err = db.Delete(author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"posts", "author_labels"} {
+		var count int64
+		err = db.Begin().Raw("SELECT count(*) FROM " + table).Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("expected the rows of %s to be deleted got %d", table, count)
+		}
+	}
+
+	// The has_many constraint is declared by the table of the books.
+	sql, err = db.CreateTableSQL(&Book{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sql.Q, "REFERENCES") {
+		t.Errorf("expected no constraint without the publishers got %s", sql.Q)
+	}
+	sql, err = db.CreateTableSQL(&Publisher{}, &Book{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `REFERENCES "publishers"("id") ON DELETE CASCADE`
+	if !strings.Contains(sql.Q, expect) {
+		t.Errorf("expected %s in %s", expect, sql.Q)
+	}
+	_, err = db.Automigrate(&Publisher{}, &Book{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher := &Publisher{Name: "ngorm", Books: []Book{{Title: "one"}}}
+	err = db.Create(publisher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Book{Title: "orphan", PublisherID: publisher.ID + 1})
+	if err == nil {
+		t.Error("expected the constraint to reject a missing publisher")
+	}
+	err = db.Delete(publisher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var books int64
+	err = db.Begin().Raw("SELECT count(*) FROM books").Scan(&books)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if books != 0 {
+		t.Errorf("expected the books to be deleted got %d", books)
+	}
+}
+
+type alteredSQLite struct {
+	sqlite.SQLite
+}
+
+func (alteredSQLite) GetName() string {
+	return "altered-sqlite"
+}
+
+func (alteredSQLite) InlineForeignKeys() bool {
+	return false
+}
+
+func init() {
+	dialects.Register("altered-sqlite", func() dialects.Dialect {
+		return &alteredSQLite{SQLite: *sqlite.New()}
+	})
+}
+
+func TestDB_ForeignKeysPlan(t *testing.T) {
+	runWrapDB(t, &wrapSQLite{dialect: "altered-sqlite"}, testDB_ForeignKeysPlan)
+}
+
+func testDB_ForeignKeysPlan(t *testing.T, db *DB) {
+	steps := func(plan *model.MigrationPlan) string {
+		var o []string
+		for _, step := range plan.Safe {
+			o = append(o, fmt.Sprintf("%s %s", step.Action, step.Table))
+		}
+		return fmt.Sprint(o)
+	}
+	plan, err := db.MigrationPlan(&Post{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "[create_table posts]"
+	if s := steps(plan); s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	plan, err = db.MigrationPlan(&Post{}, &Author{}, &Label{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "[create_table posts create_table authors create_join_table author_labels " +
+		"create_table labels add_foreign_key posts add_foreign_key author_labels " +
+		"add_foreign_key author_labels]"
+	if s := steps(plan); s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	expect = `ALTER TABLE "posts" ADD CONSTRAINT "posts_author_id_authors_id_foreign" ` +
+		`FOREIGN KEY ("author_id") REFERENCES "authors"("id") ON DELETE CASCADE`
+	if s := plan.Safe[4].SQL; s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	if strings.Contains(plan.Safe[0].SQL, "CONSTRAINT") {
+		t.Errorf("expected no inline constraint got %s", plan.Safe[0].SQL)
+	}
+
+	// The has_many constraint is created with the table of the books when
+	// both models are migrated together.
+	plan, err = db.MigrationPlan(&Book{}, &Publisher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "[create_table books create_table publishers add_foreign_key books]"
+	if s := steps(plan); s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+
+	// Otherwise adding it to the existing table of the books is destructive.
+	_, err = db.Automigrate(&Book{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err = db.MigrationPlan(&Publisher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "[create_table publishers]"
+	if s := steps(plan); s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	if len(plan.Destructive) != 1 || plan.Destructive[0].Action != model.AddForeignKey ||
+		plan.Destructive[0].Table != "books" {
+		t.Errorf("expected a destructive add_foreign_key books step got %v", plan.Destructive)
+	}
+}
+
+type Member struct {
+	ID        int64
+	Name      string `sql:"INDEX:idx_members_age_name,PRIORITY:2"`
+	Age       int64  `sql:"INDEX:idx_members_age_name,PRIORITY:1,SORT:DESC"`
+	Email     string `sql:"UNIQUE_INDEX:WHERE:deleted_at IS NULL;INDEX:idx_members_email,EXPRESSION:lower(email)"`
+	DeletedAt *time.Time
+}
+
+func TestDB_DeclaredIndexes(t *testing.T) {
+	runWrapDB(t, &wrapSQLite{}, testDB_DeclaredIndexes)
+}
+
+func testDB_DeclaredIndexes(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Member{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexes, err := db.Dialect().Indexes("members")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, index := range indexes {
+		got = append(got, fmt.Sprintf("%s %v", index.Name, index.Unique))
+	}
+	sort.Strings(got)
+	expect := "[idx_members_age_name false idx_members_email false uix_members_email true]"
+	if s := fmt.Sprint(got); s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	now := time.Now()
+	for _, m := range []*Member{
+		{Name: "a", Email: "a@example.com", DeletedAt: &now},
+		{Name: "b", Email: "a@example.com"},
+	} {
+		err = db.Create(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.Create(&Member{Name: "c", Email: "a@example.com"})
+	if err == nil {
+		t.Error("expected the partial unique index to reject a duplicate")
+	}
+	plan, err := db.MigrationPlan(&Member{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(plan.Steps()); n != 0 {
+		t.Errorf("expected no steps got %s", plan)
+	}
+
+	qdb, err := Open("ql-mem", "declared_indexes.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = qdb.Close() }()
+	_, err = qdb.MigrationPlan(&Member{})
+	if err == nil {
+		t.Error("expected ql to reject the options")
+	}
+}
+
+//singleStatementDriver is a sqlite3 driver that rejects queries with more than
+//one statement, like mysql without the multiStatements parameter.
+type singleStatementDriver struct {
+	driver.Driver
+}
+
+func (d singleStatementDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return singleStatementConn{Conn: conn}, nil
+}
+
+type singleStatementConn struct {
+	driver.Conn
+}
+
+func (c singleStatementConn) Prepare(query string) (driver.Stmt, error) {
+	if strings.Contains(strings.TrimRight(strings.TrimSpace(query), ";"), ";") {
+		return nil, fmt.Errorf("more than one statement in %q", query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func init() {
+	db, err := sql.Open("sqlite3", "")
+	if err != nil {
+		panic(err)
+	}
+	sql.Register("sqlite3-single-statement", singleStatementDriver{Driver: db.Driver()})
+	sql.Register("sqlite3-cancel", cancelDriver{Driver: db.Driver()})
+	_ = db.Close()
+}
+
+func TestDB_SingleStatements(t *testing.T) {
+	runWrapDB(t, &wrapSQLite{driver: "sqlite3-single-statement"}, testDB_SingleStatements)
+}
+
+func testDB_SingleStatements(t *testing.T, db *DB) {
+	_, err := db.Exec("CREATE TABLE a (id integer); CREATE TABLE b (id integer);")
+	if err == nil {
+		t.Fatal("expected the driver to reject more than one statement")
+	}
+	_, err = db.CreateTable(&Member{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Automigrate(&Member{}, &Author{}, &Post{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"members", "authors", "posts"} {
+		if !db.Dialect().HasTable(table) {
+			t.Errorf("expected table %s to be created", table)
+		}
+	}
+	if !db.Dialect().HasIndex("members", "idx_members_age_name") {
+		t.Error("expected the index of members to be created")
+	}
+}
+
+
+type cancelKey struct{}
+
+//withCancelAfter returns a context that is canceled by the sqlite3-cancel
+//driver once n rows were read by the queries executed with it.
+func withCancelAfter(n int) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	return context.WithValue(ctx, cancelKey{}, cancelAfter{n: n, read: new(int), cancel: cancel})
+}
+
+type cancelAfter struct {
+	n      int
+	read   *int
+	cancel context.CancelFunc
+}
+
+//cancelDriver is a sqlite3 driver that cancels the context of a query while
+//its rows are read, see withCancelAfter.
+type cancelDriver struct {
+	driver.Driver
+}
+
+func (d cancelDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return cancelConn{Conn: conn}, nil
+}
+
+type cancelConn struct {
+	driver.Conn
+}
+
+func (c cancelConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if after, ok := ctx.Value(cancelKey{}).(cancelAfter); ok {
+		return &cancelRows{Rows: rows, ctx: ctx, after: after}, nil
+	}
+	return rows, nil
+}
+
+type cancelRows struct {
+	driver.Rows
+	ctx   context.Context
+	after cancelAfter
+}
+
+func (r *cancelRows) Next(dest []driver.Value) error {
+	if *r.after.read == r.after.n {
+		r.after.cancel()
+		return r.ctx.Err()
+	}
+	*r.after.read++
+	return r.Rows.Next(dest)
+}
+
+func TestDB_CancelWhileScanning(t *testing.T) {
+	runWrapDB(t, &wrapSQLite{driver: "sqlite3-cancel"}, testDB_CancelWhileScanning)
+}
+
+func testDB_CancelWhileScanning(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stuff := range []string{"a", "b", "c"} {
+		err = db.Create(&Foo{Stuff: stuff})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var foos []Foo
+	err = db.WithContext(withCancelAfter(1)).Find(&foos)
+	if err != context.Canceled {
+		t.Errorf("expected %v got %v", context.Canceled, err)
+	}
+	var stuff []string
+	err = db.WithContext(withCancelAfter(1)).Model(&Foo{}).Pluck("stuff", &stuff)
+	if err != context.Canceled {
+		t.Errorf("expected %v got %v", context.Canceled, err)
+	}
+}
+
+func TestDB_FindInBatchesCanceled(t *testing.T) {
+	runWrapDB(t, &wrapSQLite{driver: "sqlite3-cancel"}, testDB_FindInBatchesCanceled)
+}
+
+func testDB_FindInBatchesCanceled(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Product{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		err = db.Create(&Product{Name: fmt.Sprintf("product-%d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The second batch is cut short after its first row, it must not be
+	// taken for the last one.
+	var products []Product
+	var batches int
+	err = db.WithContext(withCancelAfter(4)).FindInBatches(&products, 3, func(batch interface{}, n int) error {
+		batches = n
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("expected %v got %v", context.Canceled, err)
+	}
+	if batches != 1 {
+		t.Errorf("expected 1 batch before the error got %d", batches)
+	}
+}
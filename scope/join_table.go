@@ -1,8 +1,10 @@
 package scope
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/gernest/ngorm/engine"
@@ -66,33 +68,70 @@ func GetSearchMap(e *engine.Engine, s *model.JoinTableHandler, sources ...interf
 }
 
 // AddJoinRelation  create relationship in join table for source and destination
+//
+// The values are bound with AddToVars so the query uses the placeholders of
+// the dialect, the returned *model.Expr.Args are the e.Scope.SQLVars. The row
+// is inserted even if it exists already, see JoinRelationSQL.
 func AddJoinRelation(table string, s *model.JoinTableHandler,
 	e *engine.Engine, source interface{},
 	destination interface{}) (*model.Expr, error) {
 	searchMap := GetSearchMap(e, s, source, destination)
-
-	var assignColumns, binVars, conditions []string
-	var values []interface{}
-	for key, value := range searchMap {
-		assignColumns = append(assignColumns, Quote(e, key))
-		binVars = append(binVars, `?`)
-		conditions = append(conditions, fmt.Sprintf("%v = ?", Quote(e, key)))
-		values = append(values, value)
+	if len(searchMap) == 0 {
+		return nil, errors.New("no join table keys for the source and destination")
 	}
-
-	for _, value := range values {
-		values = append(values, value)
+	var keys []string
+	for key := range searchMap {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	quotedTable := Quote(e, table)
-	sql := fmt.Sprintf(
-		"INSERT INTO %v (%v) SELECT %v %v WHERE NOT EXISTS (SELECT * FROM %v WHERE %v)",
-		quotedTable,
+	var assignColumns, binVars []string
+	for _, key := range keys {
+		assignColumns = append(assignColumns, Quote(e, key))
+		binVars = append(binVars, AddToVars(e, searchMap[key]))
+	}
+	sql := fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)",
+		Quote(e, table),
 		strings.Join(assignColumns, ","),
 		strings.Join(binVars, ","),
-		e.Dialect.SelectFromDummyTable(),
-		quotedTable,
-		strings.Join(conditions, " AND "),
 	)
-	return &model.Expr{Q: sql, Args: values}, nil
+	return &model.Expr{Q: sql, Args: e.Scope.SQLVars}, nil
+}
+
+// JoinRelationSQL returns the query inserting the row of the join table s
+// linking source to destination, or nil if the row exists already.
+//
+// The row is looked up with e.SQLDB before, because not all databases support
+// INSERT ... SELECT ... WHERE NOT EXISTS, like ql. The query is built with a
+// clone of e.
+func JoinRelationSQL(e *engine.Engine, s *model.JoinTableHandler, source, destination interface{}) (*model.Expr, error) {
+	if s == nil {
+		return nil, errors.New("missing join table handler")
+	}
+	ne := e.Clone()
+	searchMap := GetSearchMap(ne, s, source, destination)
+	if len(searchMap) == 0 {
+		return nil, errors.New("no join table keys for the source and destination")
+	}
+	var keys []string
+	for key := range searchMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var conditions []string
+	for _, key := range keys {
+		conditions = append(conditions, fmt.Sprintf("%v = %v",
+			Quote(ne, key), AddToVars(ne, searchMap[key])))
+	}
+	var count int
+	err := ne.SQLDB.QueryRowContext(ne.Ctx, fmt.Sprintf("SELECT count(*) FROM %v WHERE %v",
+		Quote(ne, s.TableName), strings.Join(conditions, " AND ")),
+		ne.Scope.SQLVars...).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, nil
+	}
+	return AddJoinRelation(s.TableName, s, e.Clone(), source, destination)
 }
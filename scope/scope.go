@@ -11,13 +11,15 @@ import (
 	"fmt"
 	"go/ast"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gernest/ngorm/dialects"
 	"github.com/gernest/ngorm/engine"
 	"github.com/gernest/ngorm/errmsg"
 	"github.com/gernest/ngorm/model"
-	"github.com/gernest/ngorm/regexes"
 	"github.com/gernest/ngorm/util"
 	"github.com/jinzhu/inflection"
 )
@@ -331,7 +333,7 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 					if value, ok := field.TagSettings["POLYMORPHIC_VALUE"]; ok {
 						rel.PolymorphicValue = value
 					} else {
-						rel.PolymorphicValue = e.Search.TableName
+						rel.PolymorphicValue = TableName(e, modelValue)
 					}
 					polymorphicType.IsForeignKey = true
 				}
@@ -717,6 +719,11 @@ func AddToVars(e *engine.Engine, value interface{}) string {
 	}
 
 	e.Scope.SQLVars = append(e.Scope.SQLVars, value)
+	if _, ok := e.Scope.Get(model.SubQuery); ok {
+		// The placeholders of sub queries are replaced by the ones of the
+		// outer query when it is built.
+		return "?"
+	}
 	return e.Dialect.BindVar(len(e.Scope.SQLVars))
 }
 
@@ -746,7 +753,7 @@ func GetForeignField(column string, fields []*model.StructField) *model.StructFi
 }
 
 //Scan scans restult from the rows into fields.
-func Scan(rows *sql.Rows, columns []string, fields []*model.Field) {
+func Scan(rows *sql.Rows, columns []string, fields []*model.Field) error {
 	var (
 		ignored            interface{}
 		values             = make([]interface{}, len(columns))
@@ -784,7 +791,7 @@ func Scan(rows *sql.Rows, columns []string, fields []*model.Field) {
 	}
 	err := rows.Scan(values...)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
 	for index, field := range resetFields {
@@ -792,6 +799,7 @@ func Scan(rows *sql.Rows, columns []string, fields []*model.Field) {
 			field.Field.Set(v)
 		}
 	}
+	return nil
 }
 
 //SetColumn sets the column value.
@@ -838,7 +846,11 @@ func SetColumn(e *engine.Engine, column interface{}, value interface{}) error {
 func SelectAttrs(e *engine.Engine) []string {
 	if e.Scope.SelectAttrs == nil {
 		attrs := []string{}
-		for _, value := range e.Search.Selects {
+		var values []interface{}
+		if e.Search.Selects != nil {
+			values = []interface{}{e.Search.Selects.Query, e.Search.Selects.Args}
+		}
+		for _, value := range values {
 			if str, ok := value.(string); ok {
 				attrs = append(attrs, str)
 			} else if strs, ok := value.([]string); ok {
@@ -876,20 +888,44 @@ func ChangeableField(e *engine.Engine, field *model.Field) bool {
 
 //CreateTable generates CREATE TABLE SQL
 func CreateTable(e *engine.Engine, value interface{}) error {
-	var tags []string
-	var primaryKeys []string
-	var primaryKeyInColumnType = false
 	m, err := GetModelStruct(e, value)
 	if err != nil {
 		return err
 	}
+	plan := &model.MigrationPlan{}
+	err = createTable(e, value, m, plan)
+	if err != nil {
+		return err
+	}
+	e.Scope.Migration = plan
+	e.Scope.SQL = plan.Safe[0].SQL
+	for _, step := range plan.Safe[1:] {
+		e.Scope.MultiExpr = true
+		e.Scope.Exprs = append(e.Scope.Exprs, &model.Expr{Q: step.SQL})
+	}
+	return nil
+}
 
+//tableSQL returns the CREATE TABLE statement of the table of value, without
+//its join tables and indexes.
+func tableSQL(e *engine.Engine, value interface{}, m *model.Struct) (string, error) {
+	fks, err := modelForeignKeys(e, value, m)
+	if err != nil {
+		return "", err
+	}
+	constraints, err := inlineForeignKeys(e, TableName(e, value), fks)
+	if err != nil {
+		return "", err
+	}
+	var tags []string
+	var primaryKeys []string
+	var primaryKeyInColumnType = false
 	for _, field := range m.StructFields {
 		if field.IsNormal {
 			sqlTag, err := e.Dialect.DataTypeOf(field)
 			if err != nil {
 
-				return err
+				return "", err
 			}
 
 			// Check if the primary key constraint was specified as
@@ -905,11 +941,6 @@ func CreateTable(e *engine.Engine, value interface{}) error {
 		if field.IsPrimaryKey {
 			primaryKeys = append(primaryKeys, Quote(e, field.DBName))
 		}
-		err = CreateJoinTable(e, field)
-		if err != nil {
-			e.Log.Info(err.Error() + field.Name)
-			return err
-		}
 	}
 
 	var primaryKeyStr string
@@ -924,10 +955,9 @@ func CreateTable(e *engine.Engine, value interface{}) error {
 	if ok {
 		options = opts.(string)
 	}
-	e.Scope.SQL = fmt.Sprintf("CREATE TABLE %v (%v %v) %s",
+	return fmt.Sprintf("CREATE TABLE %v (%v %v%s) %s",
 		QuotedTableName(e, value), strings.Join(tags, ","),
-		primaryKeyStr, options)
-	return AutoIndex(e, value)
+		primaryKeyStr, constraints, options), nil
 }
 
 //CreateJoinTable creates a join table that handles many to many relationship.
@@ -936,17 +966,33 @@ func CreateTable(e *engine.Engine, value interface{}) error {
 //table will be users_language and containing keys that point to both users and
 //languages table.
 func CreateJoinTable(e *engine.Engine, field *model.StructField) error {
+	sql, err := joinTableSQL(e, field)
+	if err != nil {
+		return err
+	}
+	if sql != "" {
+		if !e.Scope.MultiExpr {
+			e.Scope.MultiExpr = true
+		}
+		e.Scope.Exprs = append(e.Scope.Exprs, &model.Expr{Q: sql})
+	}
+	return nil
+}
+
+//joinTableSQL returns the CREATE TABLE statement of the join table of field,
+//an empty string if field has none or the table already exists.
+func joinTableSQL(e *engine.Engine, field *model.StructField) (string, error) {
 	if rel := field.Relationship; rel != nil && rel.JoinTableHandler != nil {
 		j := rel.JoinTableHandler
 		if e.Dialect.HasTable(j.TableName) {
-			return nil
+			return "", nil
 		}
 		value := reflect.New(field.Struct.Type).Interface()
 		var sqlTypes, primaryKeys []string
 		for idx, fieldName := range rel.ForeignFieldNames {
 			f, err := FieldByName(e, value, fieldName)
 			if err != nil {
-				return err
+				return "", err
 			}
 			fk := f.Clone()
 			fk.IsPrimaryKey = false
@@ -954,7 +1000,7 @@ func CreateJoinTable(e *engine.Engine, field *model.StructField) error {
 			delete(fk.TagSettings, "AUTO_INCREMENT")
 			data, err := e.Dialect.DataTypeOf(fk)
 			if err != nil {
-				return err
+				return "", err
 			}
 			sqlTypes = append(sqlTypes,
 				Quote(e, rel.ForeignDBNames[idx])+" "+data)
@@ -965,7 +1011,7 @@ func CreateJoinTable(e *engine.Engine, field *model.StructField) error {
 		for idx, fieldName := range rel.AssociationForeignFieldNames {
 			field, err := FieldByName(e, value, fieldName)
 			if err != nil {
-				return err
+				return "", err
 			}
 			fk := field.Clone()
 			fk.IsPrimaryKey = false
@@ -973,7 +1019,7 @@ func CreateJoinTable(e *engine.Engine, field *model.StructField) error {
 			delete(fk.TagSettings, "AUTO_INCREMENT")
 			data, err := e.Dialect.DataTypeOf(fk)
 			if err != nil {
-				return err
+				return "", err
 			}
 			sqlTypes = append(sqlTypes,
 				Quote(e, rel.AssociationForeignDBNames[idx])+" "+data)
@@ -986,75 +1032,208 @@ func CreateJoinTable(e *engine.Engine, field *model.StructField) error {
 				primaryKeyStr = ", " + primaryKeyStr
 			}
 		}
-		if primaryKeyStr != "" {
-			primaryKeyStr = ", PRIMARY KEY (" + primaryKeyStr + ")"
-		}
 		var tableOpts string
 		opts, ok := e.Scope.Get(model.TableOptions)
 		if ok {
 			tableOpts = opts.(string)
 		}
 
-		sql := fmt.Sprintf("CREATE TABLE %v (%v %v) %s",
+		fks, err := foreignKeys(e, reflect.New(j.Source.ModelType).Interface(), field)
+		if err != nil {
+			return "", err
+		}
+		constraints, err := inlineForeignKeys(e, j.TableName, fks)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("CREATE TABLE %v (%v %v%s) %s",
 			Quote(e, j.TableName),
 			strings.Join(sqlTypes, ","),
-			primaryKeyStr, tableOpts)
-		if !e.Scope.MultiExpr {
-			e.Scope.MultiExpr = true
-		}
-		e.Scope.Exprs = append(e.Scope.Exprs, &model.Expr{Q: sql})
+			primaryKeyStr, constraints, tableOpts), nil
 	}
-	return nil
+	return "", nil
 }
 
-//AutoIndex generates CREATE INDEX SQL
+//AutoIndex generates CREATE INDEX SQL for the indexes declared in the tags of
+//the model value, see declaredIndexes.
 func AutoIndex(e *engine.Engine, value interface{}) error {
-	var indexes = map[string][]string{}
-	var uniqueIndexes = map[string][]string{}
-	m, err := GetModelStruct(e, value)
+	indexes, err := declaredIndexes(e, value)
 	if err != nil {
 		return err
 	}
+	for _, index := range indexes {
+		err = addIndex(e, value, index)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	for _, field := range m.StructFields {
-		if name, ok := field.TagSettings["INDEX"]; ok {
-			names := strings.Split(name, ",")
-
-			for _, name := range names {
-				if name == "INDEX" || name == "" {
-					name = fmt.Sprintf("idx_%v_%v", TableName(e, value), field.DBName)
-				}
-				indexes[name] = append(indexes[name], field.DBName)
+//declaredIndexes returns the indexes declared with the INDEX and UNIQUE_INDEX
+//tags of the fields of value, sorted by name.
+//
+// The value of the tags is a comma separated list of index names, the field is
+// a column of each of them. A name can be followed by options of the index:
+//
+//	* PRIORITY:n orders the columns of a composite index, the default is 10 and
+//	  columns with the same priority are in the order of the fields
+//	* SORT:ASC or SORT:DESC is the sort order of the column
+//	* EXPRESSION:expr indexes the SQL expression expr instead of the column
+//	* WHERE:predicate makes a partial index
+//	* TYPE:method is the index method, like btree or gin
+//
+// The options of the first name can be given without it, the default name is
+// then used. For instance
+//
+//	Name  string `sql:"INDEX:idx_name_age,PRIORITY:2;UNIQUE_INDEX:WHERE:deleted_at IS NULL"`
+//	Age   int    `sql:"INDEX:idx_name_age,PRIORITY:1,SORT:DESC"`
+//
+// declares the index idx_name_age on (age DESC, name) and the unique partial
+// index uix_<table>_name. An option whose value has commas must enclose them in
+// parentheses or quotes. The dialects reject the options they can't express,
+// see dialects.CreateIndexSQL.
+func declaredIndexes(e *engine.Engine, value interface{}) ([]*model.Index, error) {
+	m, err := GetModelStruct(e, value)
+	if err != nil {
+		return nil, err
+	}
+	type column struct {
+		name, sort string
+		priority   int
+	}
+	byName := make(map[string]*model.Index)
+	columns := make(map[string][]column)
+	var names []string
+	parse := func(field *model.StructField, key, tag, defaultName string, unique bool) error {
+		var index *model.Index
+		var c *column
+		add := func(name string) {
+			if c != nil {
+				columns[index.Name] = append(columns[index.Name], *c)
+			}
+			index = byName[name]
+			if index == nil {
+				index = &model.Index{Name: name, Unique: unique}
+				byName[name] = index
+				names = append(names, name)
 			}
+			c = &column{name: field.DBName, priority: 10}
 		}
-
-		if name, ok := field.TagSettings["UNIQUE_INDEX"]; ok {
-			names := strings.Split(name, ",")
-
-			for _, name := range names {
-				if name == "UNIQUE_INDEX" || name == "" {
-					name = fmt.Sprintf("uix_%v_%v", TableName(e, value), field.DBName)
+		set := func(option, current, v string) (string, error) {
+			if current != "" && current != v {
+				return "", fmt.Errorf("conflicting %s options of index %s: %q and %q", option, index.Name, current, v)
+			}
+			return v, nil
+		}
+		for _, item := range splitTag(tag) {
+			kv := strings.SplitN(item, ":", 2)
+			if len(kv) == 1 {
+				name := strings.TrimSpace(item)
+				if name == "" || name == key {
+					name = defaultName
+				}
+				add(name)
+				continue
+			}
+			if index == nil {
+				add(defaultName)
+			}
+			v := strings.TrimSpace(kv[1])
+			switch option := strings.ToUpper(strings.TrimSpace(kv[0])); option {
+			case "PRIORITY":
+				p, err := strconv.Atoi(v)
+				if err != nil {
+					return fmt.Errorf("invalid PRIORITY %q of index %s", v, index.Name)
 				}
-				uniqueIndexes[name] = append(uniqueIndexes[name], field.DBName)
+				c.priority = p
+			case "SORT":
+				c.sort = strings.ToUpper(v)
+				if c.sort != "ASC" && c.sort != "DESC" {
+					return fmt.Errorf("invalid SORT %q of index %s", v, index.Name)
+				}
+			case "EXPRESSION":
+				c.name = "(" + v + ")"
+			case "WHERE":
+				index.Where, err = set(option, index.Where, v)
+			case "TYPE":
+				index.Type, err = set(option, index.Type, v)
+			default:
+				return fmt.Errorf("unknown option %s of index %s", kv[0], index.Name)
+			}
+			if err != nil {
+				return err
 			}
 		}
+		if index == nil {
+			add(defaultName)
+		}
+		columns[index.Name] = append(columns[index.Name], *c)
+		return nil
 	}
-
-	for name, columns := range indexes {
-		err = AddIndex(e, false, value, name, columns...)
-		if err != nil {
-			return err
+	tableName := TableName(e, value)
+	for _, field := range m.StructFields {
+		if tag, ok := field.TagSettings["INDEX"]; ok {
+			err = parse(field, "INDEX", tag, fmt.Sprintf("idx_%v_%v", tableName, field.DBName), false)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if tag, ok := field.TagSettings["UNIQUE_INDEX"]; ok {
+			err = parse(field, "UNIQUE_INDEX", tag, fmt.Sprintf("uix_%v_%v", tableName, field.DBName), true)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
-
-	for name, columns := range uniqueIndexes {
-		err = AddIndex(e, true, value, name, columns...)
-		if err != nil {
-			return err
+	sort.Strings(names)
+	indexes := make([]*model.Index, len(names))
+	for i, name := range names {
+		index := byName[name]
+		cs := columns[name]
+		sort.SliceStable(cs, func(i, j int) bool {
+			return cs[i].priority < cs[j].priority
+		})
+		var sorted bool
+		for _, c := range cs {
+			index.Columns = append(index.Columns, c.name)
+			index.Sorts = append(index.Sorts, c.sort)
+			sorted = sorted || c.sort != ""
+		}
+		if !sorted {
+			index.Sorts = nil
 		}
+		indexes[i] = index
 	}
+	return indexes, nil
+}
 
-	return nil
+//splitTag splits the value of a tag on the commas that are not enclosed in
+//parentheses or quotes.
+func splitTag(tag string) []string {
+	var items []string
+	var depth int
+	var quote rune
+	start := 0
+	for i, r := range tag {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			items = append(items, tag[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, tag[start:])
 }
 
 //AddIndex add extra queries fo creating database index. The indexes are packed
@@ -1064,32 +1243,29 @@ func AutoIndex(e *engine.Engine, value interface{}) error {
 // if unique is true this will generate CREATE UNIQUE INDEX and in case of false
 // it generates CREATE INDEX.
 func AddIndex(e *engine.Engine, unique bool, value interface{}, indexName string, column ...string) error {
-	if e.Dialect.HasIndex(TableName(e, value), indexName) {
+	return addIndex(e, value, &model.Index{Name: indexName, Columns: column, Unique: unique})
+}
+
+func addIndex(e *engine.Engine, value interface{}, index *model.Index) error {
+	if e.Dialect.HasIndex(TableName(e, value), index.Name) {
 		return nil
 	}
-	var columns []string
-	for _, name := range column {
-		if regexes.Column.MatchString(name) {
-			name = Quote(e, name)
-		}
-		columns = append(columns, name)
-	}
-
-	sqlCreate := "CREATE INDEX"
-	if unique {
-		sqlCreate = "CREATE UNIQUE INDEX"
+	sql, err := indexSQL(e, value, index)
+	if err != nil {
+		return err
 	}
 	if !e.Scope.MultiExpr {
 		e.Scope.MultiExpr = true
 	}
-
-	//NOTE: I removed whereSQl on the create index.
-	sql := fmt.Sprintf("%s %v ON %v(%v)", sqlCreate,
-		indexName, QuotedTableName(e, value), strings.Join(columns, ", "))
 	e.Scope.Exprs = append(e.Scope.Exprs, &model.Expr{Q: sql})
 	return nil
 }
 
+//indexSQL returns the CREATE INDEX statement of index on the table of value.
+func indexSQL(e *engine.Engine, value interface{}, index *model.Index) (string, error) {
+	return dialects.CreateIndexSQL(e.Dialect, QuotedTableName(e, value), index)
+}
+
 //DropTable generates SQL query for DROP TABLE.
 //
 // The Generated SQL is not wrapped in a transaction. All state altering queries
@@ -1106,43 +1282,584 @@ func DropTable(e *engine.Engine, value interface{}) error {
 //Automigrate generates  sql for creting database table for model value if the
 //table doesnt exist yet. It also alters fields if the model has been updated.
 //
-// NOTE For the case of an updated model which will need to alter the table to
-// reflect the new changes, the SQL is stored under e.Scope.Exprs. The caller
-// must be aware of this, and remember to chceck if e.Scope.MultiExpr is true so
-// as to get the additional SQL.
+// Every change is a step of the plan stored in e.Scope.Migration. A missing
+// table is planned as a create_table step followed by the create_join_table
+// steps of its many to many fields and the add_index steps of its indexes.
+//
+// The relationships of the model get foreign key constraints, see foreignKeys.
+// They are declared in the CREATE TABLE statements or added by add_foreign_key
+// steps, depending on the dialect, see dialects.ForeignKeyer.
+//
+// For an existing table the columns and the indexes reported by the dialect
+// are compared to the fields of the model, and the changes are stored in
+// e.Scope.Migration:
+//
+//	* missing columns are added, missing indexes are created
+//	* columns whose type, nullability or default differ are altered
+//	* columns without a field are dropped
+//	* indexes that are not declared are dropped when they are named
+//	  idx_<table>_... or uix_<table>_..., other indexes are left alone
+//	* indexes whose columns differ are dropped and created again
+//
+// Dropping, changing the type of a column or making it NOT NULL and dropping
+// indexes are destructive steps. Their SQL is only added to e.Scope.Exprs when
+// the scope key model.AutomigrateDestructive is set to true.
+//
+// NOTE The SQL of the steps is stored under e.Scope.Exprs. The caller must be
+// aware of this, and remember to chceck if e.Scope.MultiExpr is true so as to
+// get the SQL.
 func Automigrate(e *engine.Engine, value interface{}) error {
+	m, err := GetModelStruct(e, value)
+	if err != nil {
+		return err
+	}
+	plan := &model.MigrationPlan{}
+	if e.Dialect.HasTable(TableName(e, value)) {
+		err = alterTable(e, value, m, plan)
+	} else {
+		err = createTable(e, value, m, plan)
+	}
+	if err != nil {
+		return err
+	}
+	e.Scope.Migration = plan
+	steps := plan.Safe
+	if allow, _ := e.Scope.Get(model.AutomigrateDestructive); allow == true {
+		steps = append(steps, plan.Destructive...)
+	}
+	for _, step := range steps {
+		if step.SQL == "" {
+			continue
+		}
+		e.Scope.MultiExpr = true
+		e.Scope.Exprs = append(e.Scope.Exprs, &model.Expr{Q: step.SQL})
+	}
+	return nil
+}
+
+//createTable adds the steps that create the table of value to plan.
+func createTable(e *engine.Engine, value interface{}, m *model.Struct, plan *model.MigrationPlan) error {
 	tableName := TableName(e, value)
-	quotedTableName := QuotedTableName(e, value)
-	if !e.Dialect.HasTable(tableName) {
-		return CreateTable(e, value)
+	sql, err := tableSQL(e, value, m)
+	if err != nil {
+		return err
 	}
-	m, err := GetModelStruct(e, value)
+	var columns []string
+	for _, field := range m.StructFields {
+		if field.IsNormal {
+			columns = append(columns, field.DBName)
+		}
+	}
+	plan.Add(&model.MigrationStep{
+		Action: model.CreateTable,
+		Table:  tableName,
+		Detail: fmt.Sprintf("with (%s)", strings.Join(columns, ", ")),
+		SQL:    sql,
+	})
+	for _, field := range m.StructFields {
+		err = joinTable(e, tableName, field, plan)
+		if err != nil {
+			return err
+		}
+	}
+	indexes, err := declaredIndexes(e, value)
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		step, err := indexStep(e, value, index)
+		if err != nil {
+			return err
+		}
+		plan.Add(step)
+	}
+	fks, err := modelForeignKeys(e, value, m)
+	if err != nil {
+		return err
+	}
+	return addForeignKeys(e, fks, plan)
+}
+
+//joinTable adds the step that creates the join table of field to plan, if
+//field has one that doesn't exist yet.
+func joinTable(e *engine.Engine, tableName string, field *model.StructField, plan *model.MigrationPlan) error {
+	sql, err := joinTableSQL(e, field)
 	if err != nil {
 		return err
 	}
+	if sql == "" {
+		return nil
+	}
+	plan.Add(&model.MigrationStep{
+		Action: model.CreateJoinTable,
+		Table:  field.Relationship.JoinTableHandler.TableName,
+		Detail: fmt.Sprintf("for %s.%s", tableName, field.DBName),
+		SQL:    sql,
+	})
+	return nil
+}
+
+//alterTable adds the steps that make the existing table of value match the
+//model to plan.
+func alterTable(e *engine.Engine, value interface{}, m *model.Struct, plan *model.MigrationPlan) error {
+	tableName := TableName(e, value)
+	quotedTableName := QuotedTableName(e, value)
+	columns, err := e.Dialect.Columns(tableName)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]model.Column)
+	for _, column := range columns {
+		existing[column.Name] = column
+	}
 	for _, field := range m.StructFields {
-		if !e.Dialect.HasColumn(tableName, field.DBName) {
-			if field.IsNormal {
+		if field.IsNormal && !field.IsIgnored {
+			column, ok := existing[field.DBName]
+			delete(existing, field.DBName)
+			if !ok {
 				sqlTag, err := e.Dialect.DataTypeOf(field)
 				if err != nil {
 					return err
 				}
-				if !e.Scope.MultiExpr {
-					e.Scope.MultiExpr = true
-				}
-				expr := &model.Expr{
-					Q: fmt.Sprintf("ALTER TABLE %v ADD %v %v;", quotedTableName,
+				plan.Add(&model.MigrationStep{
+					Action: model.AddColumn,
+					Table:  tableName,
+					Name:   field.DBName,
+					Detail: sqlTag,
+					SQL: fmt.Sprintf("ALTER TABLE %v ADD %v %v", quotedTableName,
 						Quote(e, field.DBName), sqlTag),
+				})
+			} else {
+				step, err := alterColumn(e, quotedTableName, field, column)
+				if err != nil {
+					return err
+				}
+				if step != nil {
+					step.Table = tableName
+					plan.Add(step)
 				}
-				e.Scope.Exprs = append(e.Scope.Exprs, expr)
 			}
 		}
-		err = CreateJoinTable(e, field)
+		err = joinTable(e, tableName, field, plan)
+		if err != nil {
+			return err
+		}
+	}
+	for _, column := range columns {
+		if _, ok := existing[column.Name]; ok {
+			plan.Add(&model.MigrationStep{
+				Action:      model.DropColumn,
+				Table:       tableName,
+				Name:        column.Name,
+				Detail:      "no field in the model",
+				SQL:         fmt.Sprintf("ALTER TABLE %v DROP COLUMN %v", quotedTableName, Quote(e, column.Name)),
+				Destructive: true,
+			})
+		}
+	}
+	err = diffIndexes(e, value, m, plan)
+	if err != nil {
+		return err
+	}
+	fks, err := modelForeignKeys(e, value, m)
+	if err != nil {
+		return err
+	}
+	return addForeignKeys(e, fks, plan)
+}
+
+//modelForeignKeys returns the foreign key constraints of the relationships of
+//the fields of the model value, see foreignKeys.
+//
+// The constraints on the table of value that are set on the scope with the key
+// model.AssociationForeignKeys are added too, they are the has_one and
+// has_many constraints of the other models that are migrated with value.
+func modelForeignKeys(e *engine.Engine, value interface{}, m *model.Struct) ([]*model.ForeignKey, error) {
+	var all []*model.ForeignKey
+	seen := make(map[string]bool)
+	for _, field := range m.StructFields {
+		fks, err := foreignKeys(e, value, field)
+		if err != nil {
+			return nil, err
+		}
+		for _, fk := range fks {
+			seen[fk.Name] = true
+		}
+		all = append(all, fks...)
+	}
+	if v, ok := e.Scope.Get(model.AssociationForeignKeys); ok {
+		tableName := TableName(e, value)
+		for _, fk := range v.([]*model.ForeignKey) {
+			if fk.Table == tableName && !seen[fk.Name] {
+				seen[fk.Name] = true
+				all = append(all, fk)
+			}
+		}
+	}
+	return all, nil
+}
+
+//AssociationForeignKeys returns the foreign key constraints of the has_one and
+//has_many relationships of the model value. They are on the tables of the
+//associated models, which plan them when they are migrated with value, see
+//model.AssociationForeignKeys.
+func AssociationForeignKeys(e *engine.Engine, value interface{}) ([]*model.ForeignKey, error) {
+	m, err := GetModelStruct(e, value)
+	if err != nil {
+		return nil, err
+	}
+	var all []*model.ForeignKey
+	for _, field := range m.StructFields {
+		rel := field.Relationship
+		if rel == nil || rel.Kind != "has_one" && rel.Kind != "has_many" {
+			continue
+		}
+		fks, err := foreignKeys(e, value, field)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, fks...)
+	}
+	return all, nil
+}
+
+//foreignKeys returns the foreign key constraints of the relationship of field
+//of the model value:
+//
+//	* belongs_to: on the table of value, referencing the associated table
+//	* has_one and has_many: on the associated table, referencing the table of
+//	  value
+//	* many_to_many: on the join table, referencing both tables
+//
+// Polymorphic relationships have none. The referential actions are set with
+// the CONSTRAINT tag, see foreignKeyActions.
+//
+// With dialects that declare constraints inline the has_one and has_many
+// constraints are only declared by the CREATE TABLE of the associated table,
+// when its model is migrated with the model of value.
+func foreignKeys(e *engine.Engine, value interface{}, field *model.StructField) ([]*model.ForeignKey, error) {
+	rel := field.Relationship
+	if rel == nil || rel.PolymorphicType != "" {
+		return nil, nil
+	}
+	onDelete, onUpdate, ok, err := foreignKeyActions(field)
+	if err != nil || !ok {
+		return nil, err
+	}
+	elem := field.Struct.Type
+	for elem.Kind() == reflect.Slice || elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	tableName := TableName(e, value)
+	assocTableName := TableName(e, reflect.New(elem).Interface())
+	var fks []*model.ForeignKey
+	switch rel.Kind {
+	case "belongs_to":
+		fks = append(fks, &model.ForeignKey{
+			Table: tableName, Columns: rel.ForeignDBNames,
+			RefTable: assocTableName, RefColumns: rel.AssociationForeignDBNames,
+		})
+	case "has_one", "has_many":
+		fks = append(fks, &model.ForeignKey{
+			Table: assocTableName, Columns: rel.ForeignDBNames,
+			RefTable: tableName, RefColumns: rel.AssociationForeignDBNames,
+		})
+	case "many_to_many":
+		joinTableName := rel.JoinTableHandler.TableName
+		fks = append(fks, &model.ForeignKey{
+			Table: joinTableName, Columns: rel.ForeignDBNames,
+			RefTable: tableName, RefColumns: rel.ForeignFieldNames,
+		}, &model.ForeignKey{
+			Table: joinTableName, Columns: rel.AssociationForeignDBNames,
+			RefTable: assocTableName, RefColumns: rel.AssociationForeignFieldNames,
+		})
+	}
+	for _, fk := range fks {
+		fk.Name = e.Dialect.BuildForeignKeyName(fk.Table, strings.Join(fk.Columns, "_"),
+			fmt.Sprintf("%s(%s)", fk.RefTable, strings.Join(fk.RefColumns, ",")))
+		fk.OnDelete = onDelete
+		fk.OnUpdate = onUpdate
+	}
+	return fks, nil
+}
+
+//foreignKeyActions returns the referential actions set with the CONSTRAINT tag
+//of field, like
+//
+//	Company Company `gorm:"CONSTRAINT:OnDelete:CASCADE,OnUpdate:SET NULL"`
+//
+// ok is false when the constraint is disabled with CONSTRAINT:false.
+func foreignKeyActions(field *model.StructField) (onDelete, onUpdate string, ok bool, err error) {
+	tag, set := field.TagSettings["CONSTRAINT"]
+	if !set || tag == "CONSTRAINT" {
+		return "", "", true, nil
+	}
+	if strings.EqualFold(tag, "false") {
+		return "", "", false, nil
+	}
+	for _, option := range strings.Split(tag, ",") {
+		kv := strings.SplitN(option, ":", 2)
+		if len(kv) != 2 {
+			return "", "", false, fmt.Errorf("invalid CONSTRAINT option %q of %s", option, field.Name)
+		}
+		action := strings.ToUpper(strings.Join(strings.Fields(kv[1]), " "))
+		valid := false
+		for _, a := range dialects.ReferentialActions {
+			valid = valid || a == action
+		}
+		if !valid {
+			return "", "", false, fmt.Errorf("unknown referential action %q of %s", kv[1], field.Name)
+		}
+		switch strings.ToUpper(strings.TrimSpace(kv[0])) {
+		case "ONDELETE":
+			onDelete = action
+		case "ONUPDATE":
+			onUpdate = action
+		default:
+			return "", "", false, fmt.Errorf("invalid CONSTRAINT option %q of %s", option, field.Name)
+		}
+	}
+	return onDelete, onUpdate, true, nil
+}
+
+//inlineForeignKeys returns the clauses of the constraints of fks that are on
+//the table tableName, to be added to its CREATE TABLE statement. It is empty
+//unless the dialect declares the constraints inline, see
+//dialects.ForeignKeyer.
+func inlineForeignKeys(e *engine.Engine, tableName string, fks []*model.ForeignKey) (string, error) {
+	f, ok := e.Dialect.(dialects.ForeignKeyer)
+	if !ok || !f.InlineForeignKeys() {
+		return "", nil
+	}
+	var constraints string
+	for _, fk := range fks {
+		if fk.Table != tableName {
+			continue
+		}
+		c, err := f.ForeignKeySQL(fk)
+		if err != nil {
+			return "", err
+		}
+		constraints += ", " + c
+	}
+	return constraints, nil
+}
+
+//addForeignKeys adds the steps that add the constraints fks with ALTER TABLE to
+//plan, unless the dialect declares them inline. Existing constraints are
+//skipped. Adding a constraint to an existing table is destructive, as its rows
+//may violate it.
+func addForeignKeys(e *engine.Engine, fks []*model.ForeignKey, plan *model.MigrationPlan) error {
+	f, ok := e.Dialect.(dialects.ForeignKeyer)
+	if !ok || f.InlineForeignKeys() {
+		return nil
+	}
+	for _, fk := range fks {
+		exists := e.Dialect.HasTable(fk.Table)
+		if exists && e.Dialect.HasForeignKey(fk.Table, fk.Name) {
+			continue
+		}
+		c, err := f.ForeignKeySQL(fk)
+		if err != nil {
+			return err
+		}
+		plan.Add(&model.MigrationStep{
+			Action: model.AddForeignKey,
+			Table:  fk.Table,
+			Name:   fk.Name,
+			Detail: fmt.Sprintf("(%s) references %s(%s)", strings.Join(fk.Columns, ", "),
+				fk.RefTable, strings.Join(fk.RefColumns, ", ")),
+			SQL:         fmt.Sprintf("ALTER TABLE %v ADD %s", Quote(e, fk.Table), c),
+			Destructive: exists,
+			ForeignKey:  fk,
+		})
+	}
+	return nil
+}
+
+//alterColumn returns the step that changes column to match field, nil if they
+//already match. Primary keys are never altered.
+func alterColumn(e *engine.Engine, quotedTableName string, field *model.StructField, column model.Column) (*model.MigrationStep, error) {
+	if field.IsPrimaryKey {
+		return nil, nil
+	}
+	bare := field.Clone()
+	delete(bare.TagSettings, "NOT NULL")
+	delete(bare.TagSettings, "UNIQUE")
+	delete(bare.TagSettings, "DEFAULT")
+	sqlType, err := e.Dialect.DataTypeOf(bare)
+	if err != nil {
+		return nil, err
+	}
+	to := model.Column{
+		Name:     field.DBName,
+		Type:     sqlType,
+		Nullable: field.TagSettings["NOT NULL"] == "",
+	}
+	to.Default, to.HasDefault = field.TagSettings["DEFAULT"]
+	var (
+		changes     []string
+		destructive bool
+	)
+	if !dialects.SameType(column.Type, to.Type) {
+		changes = append(changes, fmt.Sprintf("type %s to %s", column.Type, to.Type))
+		destructive = true
+	}
+	if column.Nullable != to.Nullable {
+		if to.Nullable {
+			changes = append(changes, "NOT NULL to NULL")
+		} else {
+			changes = append(changes, "NULL to NOT NULL")
+			destructive = true
+		}
+	}
+	if column.HasDefault != to.HasDefault ||
+		(to.HasDefault && !dialects.SameDefault(column.Default, to.Default)) {
+		switch {
+		case !to.HasDefault:
+			changes = append(changes, fmt.Sprintf("drop default %s", column.Default))
+		case !column.HasDefault:
+			changes = append(changes, fmt.Sprintf("set default %s", to.Default))
+		default:
+			changes = append(changes, fmt.Sprintf("default %s to %s", column.Default, to.Default))
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	step := &model.MigrationStep{
+		Action:      model.AlterColumn,
+		Name:        field.DBName,
+		Detail:      strings.Join(changes, ", "),
+		Destructive: destructive,
+	}
+	if a, ok := e.Dialect.(dialects.ColumnAlterer); ok {
+		step.SQL = a.AlterColumnSQL(quotedTableName, column, to)
+	}
+	return step, nil
+}
+
+//diffIndexes adds to plan the steps that make the indexes of the table of value
+//match the indexes declared in m.
+//
+// Only indexes named the way ngorm names them, idx_<table>_... and
+// uix_<table>_..., are dropped when they are no longer declared. Any other
+// index is assumed to be added by hand and is left alone.
+func diffIndexes(e *engine.Engine, value interface{}, m *model.Struct, plan *model.MigrationPlan) error {
+	tableName := TableName(e, value)
+	indexes, err := e.Dialect.Indexes(tableName)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]model.Index)
+	for _, index := range indexes {
+		existing[index.Name] = index
+	}
+	declared, err := declaredIndexes(e, value)
+	if err != nil {
+		return err
+	}
+	for _, index := range declared {
+		current, ok := existing[index.Name]
+		delete(existing, index.Name)
+		create, err := indexStep(e, value, index)
 		if err != nil {
 			return err
 		}
+		if !ok {
+			plan.Add(create)
+			continue
+		}
+		if current.Unique == index.Unique && (hasExpression(index) ||
+			strings.Join(current.Columns, ",") == strings.Join(index.Columns, ",")) {
+			continue
+		}
+		plan.Add(&model.MigrationStep{
+			Action:      model.DropIndex,
+			Table:       tableName,
+			Name:        index.Name,
+			Detail:      fmt.Sprintf("changed from (%s)", strings.Join(current.Columns, ", ")),
+			SQL:         dialects.DropIndexSQL(e.Dialect, tableName, index.Name),
+			Destructive: true,
+		})
+		create.Destructive = true
+		plan.Add(create)
+	}
+	for _, index := range indexes {
+		if _, ok := existing[index.Name]; !ok {
+			continue
+		}
+		if !strings.HasPrefix(index.Name, "idx_"+tableName+"_") &&
+			!strings.HasPrefix(index.Name, "uix_"+tableName+"_") {
+			continue
+		}
+		if index.Unique && len(index.Columns) == 1 {
+			// mysql reports the UNIQUE setting of a column as an index
+			// named after the column.
+			if field, ok := fieldByDBName(m, index.Columns[0]); ok && field.TagSettings["UNIQUE"] != "" {
+				continue
+			}
+		}
+		plan.Add(&model.MigrationStep{
+			Action:      model.DropIndex,
+			Table:       tableName,
+			Name:        index.Name,
+			Detail:      "not declared in the model",
+			SQL:         dialects.DropIndexSQL(e.Dialect, tableName, index.Name),
+			Destructive: true,
+		})
 	}
-	return AutoIndex(e, value)
+	return nil
+}
+
+//indexStep returns the step that creates index on the table of value.
+func indexStep(e *engine.Engine, value interface{}, index *model.Index) (*model.MigrationStep, error) {
+	sql, err := indexSQL(e, value, index)
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	for i, column := range index.Columns {
+		if i < len(index.Sorts) && index.Sorts[i] != "" {
+			column += " " + index.Sorts[i]
+		}
+		columns = append(columns, column)
+	}
+	detail := fmt.Sprintf("on (%s)", strings.Join(columns, ", "))
+	if index.Type != "" {
+		detail += " using " + index.Type
+	}
+	if index.Where != "" {
+		detail += " where " + index.Where
+	}
+	return &model.MigrationStep{
+		Action: model.AddIndex,
+		Table:  TableName(e, value),
+		Name:   index.Name,
+		Detail: detail,
+		SQL:    sql,
+	}, nil
+}
+
+//hasExpression returns true if a column of index is an SQL expression. The
+//databases don't report the expressions of their indexes in the same form, so
+//only the names and the uniqueness of these indexes are compared.
+func hasExpression(index *model.Index) bool {
+	for _, column := range index.Columns {
+		if strings.HasPrefix(column, "(") {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldByDBName(m *model.Struct, name string) (*model.StructField, bool) {
+	for _, field := range m.StructFields {
+		if field.DBName == name {
+			return field, true
+		}
+	}
+	return nil, false
 }
 
 //ShouldSaveAssociation return true if indeed we want the association to me
@@ -1326,8 +2043,68 @@ func SaveFieldAsAssociation(e *engine.Engine, field *model.Field) (bool, *model.
 //
 func Initialize(e *engine.Engine) {
 	for _, clause := range e.Search.WhereConditions {
-		UpdatedAttrsWithValues(e, clause["query"])
+		UpdatedAttrsWithValues(e, clause.Query)
 	}
 	UpdatedAttrsWithValues(e, e.Search.InitAttrs)
 	UpdatedAttrsWithValues(e, e.Search.AssignAttrs)
 }
+
+//ColumnAsArray returns the values of the struct fields named columns for
+//every struct in values. The values can be structs, pointers to structs or
+//slices of them.
+//
+// Rows whose columns are all blank are skipped. The result is suitable for
+// building IN conditions with util.ToQueryMarks and util.ToQueryValues.
+func ColumnAsArray(columns []string, values ...interface{}) (results [][]interface{}) {
+	for _, value := range values {
+		v := reflect.Indirect(reflect.ValueOf(value))
+		switch v.Kind() {
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				if r := columnValues(reflect.Indirect(v.Index(i)), columns); r != nil {
+					results = append(results, r)
+				}
+			}
+		case reflect.Struct:
+			if r := columnValues(v, columns); r != nil {
+				results = append(results, r)
+			}
+		}
+	}
+	return
+}
+
+func columnValues(v reflect.Value, columns []string) []interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	var result []interface{}
+	var hasValue bool
+	for _, column := range columns {
+		field := v.FieldByName(column)
+		if !field.IsValid() {
+			return nil
+		}
+		if !util.IsBlank(field) {
+			hasValue = true
+		}
+		result = append(result, field.Interface())
+	}
+	if !hasValue {
+		return nil
+	}
+	return result
+}
+
+//ToQueryCondition returns quoted columns ready to be used on the left side of
+//an IN condition. Multiple columns are grouped in brackets.
+func ToQueryCondition(e *engine.Engine, columns []string) string {
+	var quoted []string
+	for _, column := range columns {
+		quoted = append(quoted, Quote(e, column))
+	}
+	if len(quoted) > 1 {
+		return fmt.Sprintf("(%v)", strings.Join(quoted, ","))
+	}
+	return strings.Join(quoted, ",")
+}
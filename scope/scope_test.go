@@ -1,6 +1,7 @@
 package scope
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/gernest/ngorm/dialects/ql"
@@ -104,3 +105,80 @@ func TestTableName(t *testing.T) {
 	}
 
 }
+
+func TestAddJoinRelation(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	user := &fixture.User{ID: 1}
+	language := &fixture.Language{Model: model.Model{ID: 2}}
+	m, err := GetModelStruct(e, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j *model.JoinTableHandler
+	for _, field := range m.StructFields {
+		if field.Name == "Languages" {
+			j = field.Relationship.JoinTableHandler
+		}
+	}
+	if j == nil {
+		t.Fatal("missing join table handler")
+	}
+	expr, err := AddJoinRelation(j.TableName, j, e, user, language)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "INSERT INTO user_languages (language_id,user_id) VALUES ($1,$2)"
+	if expr.Q != expect {
+		t.Errorf("expected %s got %s", expect, expr.Q)
+	}
+	if len(expr.Args) != 2 {
+		t.Errorf("expected 2 args got %v", expr.Args)
+	}
+}
+
+type indexed struct {
+	ID      int64
+	Name    string `sql:"INDEX:idx_name_age,PRIORITY:2;UNIQUE_INDEX:WHERE:deleted_at IS NULL"`
+	Age     int64  `sql:"INDEX:idx_name_age,PRIORITY:1,SORT:DESC"`
+	Email   string `sql:"INDEX:idx_email,EXPRESSION:lower(email),TYPE:btree,idx_email_status"`
+	Status  string `sql:"INDEX:idx_email_status,WHERE:status IN ('a','b')"`
+	Deleted bool
+}
+
+func TestDeclaredIndexes(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = &ql.QL{}
+	indexes, err := declaredIndexes(e, &indexed{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, index := range indexes {
+		got = append(got, fmt.Sprintf("%s %v %v %v %q %q", index.Name, index.Unique,
+			index.Columns, index.Sorts, index.Where, index.Type))
+	}
+	expect := []string{
+		`idx_email false [(lower(email))] [] "" "btree"`,
+		`idx_email_status false [email status] [] "status IN ('a','b')" ""`,
+		`idx_name_age false [age name] [DESC ] "" ""`,
+		`uix_indexeds_name true [name] [] "deleted_at IS NULL" ""`,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+
+	type conflict struct {
+		A string `sql:"INDEX:idx_ab,WHERE:a > 1"`
+		B string `sql:"INDEX:idx_ab,WHERE:b > 1"`
+	}
+	type unknown struct {
+		A string `sql:"INDEX:idx_a,LENGTH:10"`
+	}
+	for _, v := range []interface{}{&conflict{}, &unknown{}} {
+		_, err = declaredIndexes(e, v)
+		if err == nil {
+			t.Errorf("expected an error for %T", v)
+		}
+	}
+}
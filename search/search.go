@@ -12,17 +12,17 @@ import (
 
 //Where adds WHERE search condition.
 func Where(e *engine.Engine, query interface{}, values ...interface{}) {
-	e.Search.WhereConditions = append(e.Search.WhereConditions, map[string]interface{}{"query": query, "args": values})
+	e.Search.WhereConditions = append(e.Search.WhereConditions, &model.Clause{Query: query, Args: values})
 }
 
 //Not adds NOT search condition
 func Not(e *engine.Engine, query interface{}, values ...interface{}) {
-	e.Search.NotConditions = append(e.Search.NotConditions, map[string]interface{}{"query": query, "args": values})
+	e.Search.NotConditions = append(e.Search.NotConditions, &model.Clause{Query: query, Args: values})
 }
 
 //Or add OR search condition
 func Or(e *engine.Engine, query interface{}, values ...interface{}) {
-	e.Search.OrConditions = append(e.Search.OrConditions, map[string]interface{}{"query": query, "args": values})
+	e.Search.OrConditions = append(e.Search.OrConditions, &model.Clause{Query: query, Args: values})
 }
 
 //Attr add attributes
@@ -51,7 +51,7 @@ func Select(e *engine.Engine, query interface{}, values ...interface{}) {
 	if regexes.DistinctSQL.MatchString(fmt.Sprint(query)) {
 		e.Search.IgnoreOrderQuery = true
 	}
-	e.Search.Selects = map[string]interface{}{"query": query, "args": values}
+	e.Search.Selects = &model.Clause{Query: query, Args: values}
 }
 
 //Omit ommits seacrh condition
@@ -82,12 +82,12 @@ func Group(e *engine.Engine, query interface{}) error {
 
 //Having add HAVING condition
 func Having(e *engine.Engine, query interface{}, values ...interface{}) {
-	e.Search.HavingConditions = append(e.Search.HavingConditions, map[string]interface{}{"query": query, "args": values})
+	e.Search.HavingConditions = append(e.Search.HavingConditions, &model.Clause{Query: query, Args: values})
 }
 
 //Join add JOIN condition
 func Join(e *engine.Engine, query interface{}, values ...interface{}) {
-	e.Search.JoinConditions = append(e.Search.JoinConditions, map[string]interface{}{"query": query, "args": values})
+	e.Search.JoinConditions = append(e.Search.JoinConditions, &model.Clause{Query: query, Args: values})
 }
 
 //Preload add preloading condition
@@ -110,7 +110,9 @@ func indirect(reflectValue reflect.Value) reflect.Value {
 	return reflectValue
 }
 
-func toQueryMarks(primaryValues [][]interface{}) string {
+//ToQueryMarks returns ? placeholders for primaryValues. Composite values are
+//grouped in brackets, so [[1,2],[3,4]] becomes (?,?),(?,?).
+func ToQueryMarks(primaryValues [][]interface{}) string {
 	var results []string
 
 	for _, primaryValue := range primaryValues {
@@ -128,7 +130,9 @@ func toQueryMarks(primaryValues [][]interface{}) string {
 	return strings.Join(results, ",")
 }
 
-func toQueryValues(values [][]interface{}) (results []interface{}) {
+//ToQueryValues flattens values in the same order as the placeholders returned
+//by ToQueryMarks.
+func ToQueryValues(values [][]interface{}) (results []interface{}) {
 	for _, value := range values {
 		for _, v := range value {
 			results = append(results, v)
@@ -169,15 +173,19 @@ func toSearchableMap(attrs ...interface{}) (result interface{}) {
 	return
 }
 
-func equalAsString(a interface{}, b interface{}) bool {
-	return toString(a) == toString(b)
+//EqualAsString returns true if the string representations of a and b are
+//the same.
+func EqualAsString(a interface{}, b interface{}) bool {
+	return ToString(a) == ToString(b)
 }
 
-func toString(str interface{}) string {
+//ToString returns a string representation of str. Elements of a slice of
+//values are joined with _.
+func ToString(str interface{}) string {
 	if values, ok := str.([]interface{}); ok {
 		var results []string
 		for _, value := range values {
-			results = append(results, toString(value))
+			results = append(results, ToString(value))
 		}
 		return strings.Join(results, "_")
 	} else if bytes, ok := str.([]byte); ok {
@@ -188,7 +196,9 @@ func toString(str interface{}) string {
 	return ""
 }
 
-func makeSlice(elemType reflect.Type) interface{} {
+//MakeSlice returns a pointer to an empty slice of elemType. If elemType is a
+//slice then its element type is used instead.
+func MakeSlice(elemType reflect.Type) interface{} {
 	if elemType.Kind() == reflect.Slice {
 		elemType = elemType.Elem()
 	}
@@ -207,8 +217,8 @@ func strInSlice(a string, list []string) bool {
 	return false
 }
 
-// getValueFromFields return given fields's value
-func getValueFromFields(value reflect.Value, fieldNames []string) (results []interface{}) {
+//GetValueFromFields return given fields's value
+func GetValueFromFields(value reflect.Value, fieldNames []string) (results []interface{}) {
 	// If value is a nil pointer, Indirect returns a zero Value!
 	// Therefor we need to check for a zero value,
 	// as FieldByName could panic
@@ -271,3 +281,15 @@ COMMIT;
 `
 	return fmt.Sprintf(t, tx)
 }
+
+//UnwrapTX removes the BEGIN TRANSACTION; and COMMIT; statements that surround
+//the query. This is used when the query is executed in a transaction that is
+//already running, so the transaction is not committed by the query itself.
+func UnwrapTX(query string) string {
+	q := strings.TrimSpace(query)
+	if !strings.HasPrefix(q, "BEGIN TRANSACTION;") || !strings.HasSuffix(q, "COMMIT;") {
+		return query
+	}
+	q = strings.TrimPrefix(q, "BEGIN TRANSACTION;")
+	return strings.TrimSuffix(q, "COMMIT;")
+}